@@ -15,12 +15,21 @@ type Answerer struct {
 	onIceCandidate   func(candidate *webrtc.ICECandidate)
 	cachedCandidates []webrtc.ICECandidateInit
 
+	onClose   func()
+	closeOnce sync.Once
+	created   time.Time
+	framing   FramingVersion
+	states    *connectionStates
+
+	compression Compression
+
 	sync.Mutex
 }
 
 func NewAnswerer() *Answerer {
 	return &Answerer{
 		channel: make(chan *webrtc.DataChannel, 1),
+		created: time.Now(),
 	}
 }
 
@@ -33,13 +42,23 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 		ICECandidatePoolSize: 10,
 	}
 
-	connection, err := webrtc.NewPeerConnection(config)
+	connection, err := newPeerConnection(config, answerConfig.SettingEngine, answerConfig.DetachDataChannels)
 	if err != nil {
 		return nil, err
 	}
 
+	states := watchConnectionStates(connection)
+	states.add(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			a.closed()
+		}
+	})
+
 	a.Lock()
 	a.connection = connection
+	a.states = states
+	a.framing = negotiateFraming(offer.Framing)
+	a.compression = negotiateCompression(a.framing, offer.Compression)
 	a.Unlock()
 
 	if err = connection.SetRemoteDescription(offer.Description); err != nil {
@@ -62,18 +81,20 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 	a.cachedCandidates = nil
 	a.Unlock()
 
-	done := make(chan struct{})
+	done := make(chan struct{}, 1)
+	// Guarded by the lock, the callback runs on a pion goroutine.
 	var trickle = false
 	var initialCandidates []webrtc.ICECandidateInit
 	connection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate == nil {
 			log.Debugf("ice candidates gathering took %s", time.Since(start))
+			a.trickleCandidate(nil)
 			return
 		}
 
-		if trickle || time.Now().After(end) {
-			a.onIceCandidate(candidate)
-		} else {
+		a.Lock()
+		initial := !trickle && time.Now().Before(end)
+		if initial {
 			initialCandidates = append(initialCandidates, candidate.ToJSON())
 			// host candidate gathering is done, any further candidates should
 			// be signaled with Trickle ICE.
@@ -82,6 +103,11 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 				done <- struct{}{}
 			}
 		}
+		a.Unlock()
+
+		if !initial {
+			a.trickleCandidate(candidate)
+		}
 	})
 
 	var once sync.Once
@@ -103,8 +129,21 @@ func (a *Answerer) Answer(answerConfig *AnswerConfig, offer Offer, trickleAfter
 	case <-time.After(time.Until(end)):
 	}
 
+	// Candidates gathered from now on are trickled, none may get lost in between.
+	a.Lock()
+	trickle = true
+	candidates := initialCandidates
+	a.Unlock()
+
+	var compressions []Compression
+	if compression := a.Compression(); compression != CompressionNone {
+		compressions = []Compression{compression}
+	}
+
 	return &Answer{
-		Candidates:  initialCandidates,
+		Framing:     a.Framing(),
+		Compression: compressions,
+		Candidates:  candidates,
 		Description: answer,
 	}, nil
 }
@@ -116,6 +155,63 @@ func (a *Answerer) OnIceCandidate(callback func(candidate *webrtc.ICECandidate))
 	a.onIceCandidate = callback
 }
 
+// OnClose sets a callback invoked once the peer connection has failed or was closed.
+func (a *Answerer) OnClose(callback func()) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.onClose = callback
+}
+
+func (a *Answerer) closed() {
+	a.closeOnce.Do(func() {
+		a.Lock()
+		callback := a.onClose
+		a.Unlock()
+
+		if callback != nil {
+			callback()
+		}
+	})
+}
+
+func (a *Answerer) Close() error {
+	a.Lock()
+	connection := a.connection
+	a.Unlock()
+
+	// The connection may have failed before it could report its state, the close
+	// callback must run either way.
+	defer a.closed()
+
+	if connection == nil {
+		return nil
+	}
+
+	return connection.Close()
+}
+
+// orphaned reports whether the answerer never received an offer within maxAge,
+// which happens when candidates arrive for a request that is never made.
+func (a *Answerer) orphaned(maxAge time.Duration) bool {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.connection == nil && time.Since(a.created) > maxAge
+}
+
+// trickleCandidate hands a candidate gathered after the answer was created to the
+// OnIceCandidate callback, nil marks the end of candidates.
+func (a *Answerer) trickleCandidate(candidate *webrtc.ICECandidate) {
+	a.Lock()
+	callback := a.onIceCandidate
+	a.Unlock()
+
+	if callback != nil {
+		callback(candidate)
+	}
+}
+
 func (a *Answerer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 	a.Lock()
 	defer a.Unlock()
@@ -128,6 +224,43 @@ func (a *Answerer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 	}
 }
 
+// Framing returns the framing version agreed on with the offerer.
+func (a *Answerer) Framing() FramingVersion {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.framing
+}
+
+func (a *Answerer) Connection() *webrtc.PeerConnection {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.connection
+}
+
+// session returns the session running over channel, which must belong to the connection.
+func (a *Answerer) session(channel *webrtc.DataChannel) *WebRTCSession {
+	a.Lock()
+	defer a.Unlock()
+
+	return &WebRTCSession{
+		Connection:  a.connection,
+		Channel:     channel,
+		Framing:     a.framing,
+		Compression: a.compression,
+		states:      a.states,
+	}
+}
+
 func (a *Answerer) WaitReady() chan *webrtc.DataChannel {
 	return a.channel
 }
+
+// Compression returns the message compression agreed on with the offerer.
+func (a *Answerer) Compression() Compression {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.compression
+}
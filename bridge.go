@@ -0,0 +1,107 @@
+package wamp_webrtc_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/xconnio/wampproto-go/transports"
+	"github.com/xconnio/xconn-go"
+)
+
+const bridgeDialTimeout = 10 * time.Second
+
+func serializerSpec(subProtocol string) (xconn.SerializerSpec, error) {
+	specs := []xconn.SerializerSpec{
+		xconn.JSONSerializerSpec,
+		xconn.CBORSerializerSpec,
+		xconn.MsgPackSerializerSpec,
+		xconn.ProtobufSerializerSpec,
+		xconn.CapnprotoSplitSerializerSpec,
+	}
+
+	for _, spec := range specs {
+		if spec.SubProtocol() == subProtocol {
+			return spec, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported serializer protocol: %q", subProtocol)
+}
+
+// dialUpstream opens a transport to the router at uri that speaks the same
+// serializer as the WebRTC client, so messages can be relayed without decoding.
+func dialUpstream(ctx context.Context, uri, subProtocol string) (xconn.Peer, error) {
+	spec, err := serializerSpec(subProtocol)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedURL, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsedURL.Scheme {
+	case "ws", "wss", "unix+ws":
+		return xconn.DialWebSocket(ctx, parsedURL, &xconn.WSDialerConfig{
+			SubProtocol: spec.SubProtocol(),
+			DialTimeout: bridgeDialTimeout,
+		})
+	case "rs", "rss", "unix", "unix+rs":
+		return xconn.DialRawSocket(ctx, parsedURL, &xconn.RawSocketDialerConfig{
+			Serializer:  transports.Serializer(spec.SerializerID()),
+			DialTimeout: bridgeDialTimeout,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", uri)
+	}
+}
+
+// bridgeClient relays all messages between the WebRTC peer and a dedicated upstream
+// connection. The upstream router handles the session establishment, including
+// authentication, so the WebRTC client joins it like any other client would.
+func bridgeClient(peer *WebRTCPeer, subProtocol, uri string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bridgeDialTimeout)
+	defer cancel()
+
+	upstream, err := dialUpstream(ctx, uri, subProtocol)
+	if err != nil {
+		_ = peer.Close()
+		return fmt.Errorf("failed to connect to upstream router: %w", err)
+	}
+
+	errs := make(chan error, 2)
+	go relay(peer, upstream, errs)
+	go relay(upstream, peer, errs)
+
+	// Once either side is gone, the other one is of no use anymore.
+	err = <-errs
+	_ = peer.Close()
+	_ = upstream.NetConn().Close()
+
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func relay(from, to xconn.Peer, errs chan error) {
+	for {
+		payload, err := from.Read()
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		if err = to.Write(payload); err != nil {
+			errs <- err
+			return
+		}
+	}
+}
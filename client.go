@@ -1,8 +1,9 @@
 package wamp_webrtc_go
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
@@ -12,6 +13,12 @@ import (
 	"github.com/xconnio/xconn-go"
 )
 
+// ClientConfig configures a client connecting over WebRTC. ICEServers lists the STUN and
+// TURN servers used to gather candidates, set ICETransportPolicy to
+// webrtc.ICETransportPolicyRelay to only connect through TURN. If ProcedureICEServers is
+// set, the servers of the provider are fetched through Session before every offer.
+// SettingEngine tunes the peer connection, see OfferConfig. A Signaler is owned by the
+// caller, it may serve several connection attempts and is never closed by the client.
 type ClientConfig struct {
 	Realm                    string
 	ProcedureWebRTCOffer     string
@@ -20,114 +27,177 @@ type ClientConfig struct {
 	Serializer               xconn.SerializerSpec
 	Authenticator            auth.ClientAuthenticator
 	Session                  *xconn.Session
+	Signaler                 OffererSignaler
+	PeerConfig               *PeerConfig
+	ICEServers               []webrtc.ICEServer
+	ICETransportPolicy       webrtc.ICETransportPolicy
+	ProcedureICEServers      string
+	SettingEngine            *webrtc.SettingEngine
 }
 
-func connectWebRTC(config *ClientConfig) (*WebRTCSession, error) {
-	if config.Session == nil {
-		return nil, fmt.Errorf("invalid client config: Session must not be nil")
+// signaler returns the signaler configured for the client, falling back to signaling
+// through the WAMP session. The fallback serves a single connection attempt and must be
+// closed once it is done, owned reports whether that is up to the caller.
+func (c *ClientConfig) signaler() (_ OffererSignaler, owned bool, _ error) {
+	if c.Signaler != nil {
+		return c.Signaler, true, nil
 	}
-	offerer := NewOfferer()
-	offerConfig := &OfferConfig{
-		Protocol:                 config.Serializer.SubProtocol(),
-		ICEServers:               []webrtc.ICEServer{},
-		Ordered:                  true,
-		TopicAnswererOnCandidate: config.TopicAnswererOnCandidate,
+
+	if c.Session == nil {
+		return nil, false, fmt.Errorf("invalid client config: either Signaler or Session must be set")
 	}
 
-	subscribeResponse := config.Session.Subscribe(config.TopicOffererOnCandidate, func(event *xconn.Event) {
-		if len(event.Args()) < 2 {
-			log.Errorf("invalid arguments length")
-			return
-		}
+	return NewWAMPOffererSignaler(c.Session, c.ProcedureWebRTCOffer, c.TopicAnswererOnCandidate,
+		c.TopicOffererOnCandidate), false, nil
+}
+
+func connectWebRTC(ctx context.Context, config *ClientConfig) (_ *WebRTCSession, err error) {
+	signaler, owned, err := config.signaler()
+	if err != nil {
+		return nil, err
+	}
+
+	// Signaling is only needed until ICE either connects or fails.
+	if !owned {
+		defer func() {
+			if err := signaler.Close(); err != nil {
+				log.Debugf("failed to close signaler: %v", err)
+			}
+		}()
+	}
 
-		candidateJSON, err := event.ArgString(1)
+	iceServers := config.ICEServers
+	if config.ProcedureICEServers != "" && config.Session != nil {
+		servers, err := fetchICEServers(ctx, config.Session, config.ProcedureICEServers)
 		if err != nil {
-			log.Errorln("offer must be a string")
-			return
+			return nil, fmt.Errorf("failed to fetch ice servers: %w", err)
 		}
 
-		var candidate webrtc.ICECandidateInit
-		if err := json.Unmarshal([]byte(candidateJSON), &candidate); err != nil {
-			log.Errorln(err)
+		iceServers = append(slices.Clone(iceServers), servers...)
+	}
+
+	offerer := NewOfferer()
+	offerConfig := &OfferConfig{
+		Protocol:           config.Serializer.SubProtocol(),
+		ICEServers:         iceServers,
+		ICETransportPolicy: config.ICETransportPolicy,
+		SettingEngine:      config.SettingEngine,
+		Ordered:            true,
+	}
+
+	requestID := uuid.New().String()
+	err = signaler.OnCandidate(func(candidateRequestID string, candidate *webrtc.ICECandidateInit) {
+		// The signaling channel may be shared by many offerers, only take the candidates meant for us.
+		if candidateRequestID != requestID || candidate == nil {
 			return
 		}
 
-		if err = offerer.AddICECandidate(candidate); err != nil {
+		if err := offerer.AddICECandidate(*candidate); err != nil {
 			log.Errorln(err)
 		}
-	}).Do()
-	if subscribeResponse.Err != nil {
-		return nil, subscribeResponse.Err
-	}
-
-	requestID := uuid.New().String()
-	offer, err := offerer.Offer(offerConfig, config.Session, requestID)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	offerJSON, err := json.Marshal(offer)
-	if err != nil {
+	defer func() {
+		if err != nil {
+			_ = offerer.Close()
+		}
+	}()
+
+	if err = ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	callResponse := config.Session.Call(config.ProcedureWebRTCOffer).Args(requestID, string(offerJSON)).Do()
-	if callResponse.Err != nil {
-		return nil, callResponse.Err
+	offer, err := offerer.Offer(offerConfig, signaler, requestID)
+	if err != nil {
+		return nil, err
 	}
 
-	answerText, err := callResponse.Args[0].String()
+	answer, err := signaler.SendOffer(ctx, requestID, offer)
 	if err != nil {
 		return nil, err
 	}
-	var answer Answer
-	if err = json.Unmarshal([]byte(answerText), &answer); err != nil {
+
+	if err = offerer.HandleAnswer(*answer); err != nil {
 		return nil, err
 	}
 
-	if err = offerer.HandleAnswer(answer); err != nil {
-		return nil, err
+	select {
+	case channel := <-offerer.WaitReady():
+		return &WebRTCSession{
+			Channel:     channel,
+			Connection:  offerer.connection,
+			Framing:     offerer.Framing(),
+			Compression: offerer.Compression(),
+			states:      offerer.states,
+		}, nil
+	case <-offerer.failed:
+		return nil, ErrConnectionFailed
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
 
-	channel := <-offerer.WaitReady()
+// join establishes the WAMP session over the data channel, giving up once ctx is done.
+func join(ctx context.Context, webRTCSession *WebRTCSession, config *ClientConfig) (xconn.BaseSession, error) {
+	type joinResult struct {
+		base xconn.BaseSession
+		err  error
+	}
+
+	results := make(chan joinResult, 1)
+	go func() {
+		peer := NewWebRTCPeer(webRTCSession, config.PeerConfig)
+		base, err := xconn.Join(peer, config.Realm, config.Serializer.Serializer(), config.Authenticator)
+		results <- joinResult{base: base, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		if result.err != nil {
+			_ = webRTCSession.Connection.Close()
+		}
 
-	return &WebRTCSession{
-		Channel:    channel,
-		Connection: offerer.connection,
-	}, nil
+		return result.base, result.err
+	case <-ctx.Done():
+		_ = webRTCSession.Connection.Close()
+		return nil, ctx.Err()
+	}
 }
 
 func ConnectWebRTC(config *ClientConfig) (*WebRTCSession, error) {
-	webRTCSession, err := connectWebRTC(config)
+	return ConnectWebRTCContext(context.Background(), config)
+}
+
+func ConnectWebRTCContext(ctx context.Context, config *ClientConfig) (*WebRTCSession, error) {
+	webRTCSession, err := connectWebRTC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	peer := NewWebRTCPeer(webRTCSession.Channel)
-	_, err = xconn.Join(peer, config.Realm, config.Serializer.Serializer(), config.Authenticator)
-	if err != nil {
+	if _, err = join(ctx, webRTCSession, config); err != nil {
 		return nil, err
 	}
 
-	return &WebRTCSession{
-		Channel:    webRTCSession.Channel,
-		Connection: webRTCSession.Connection,
-	}, nil
+	return webRTCSession, nil
 }
 
 func ConnectWAMP(config *ClientConfig) (*xconn.Session, error) {
-	webRTCConnection, err := connectWebRTC(config)
+	return ConnectWAMPContext(context.Background(), config)
+}
+
+func ConnectWAMPContext(ctx context.Context, config *ClientConfig) (*xconn.Session, error) {
+	webRTCSession, err := connectWebRTC(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	peer := NewWebRTCPeer(webRTCConnection.Channel)
-	base, err := xconn.Join(peer, config.Realm, config.Serializer.Serializer(), config.Authenticator)
+	base, err := join(ctx, webRTCSession, config)
 	if err != nil {
 		return nil, err
 	}
 
-	wampSession := xconn.NewSession(base, config.Serializer.Serializer())
-
-	return wampSession, nil
+	return xconn.NewSession(base, config.Serializer.Serializer()), nil
 }
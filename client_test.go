@@ -0,0 +1,78 @@
+package wamp_webrtc_go_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/xconn-go"
+)
+
+func TestConnectWAMPContext(t *testing.T) {
+	router := xconn.NewRouter()
+	require.NoError(t, router.AddRealm("realm1"))
+
+	callee, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+
+	// Never answer the offer, the client must give up once the context is done.
+	blocked := make(chan struct{})
+	t.Cleanup(func() { close(blocked) })
+	handleOffer := func(_ context.Context, _ *xconn.Invocation) *xconn.InvocationResult {
+		<-blocked
+		return xconn.NewInvocationResult()
+	}
+	registerResp := callee.Register(procedureWebRTCOffer, handleOffer).Do()
+	require.NoError(t, registerResp.Err)
+
+	session, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = wamp_webrtc_go.ConnectWAMPContext(ctx, wampClientConfig(session))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConnectWAMPConcurrent(t *testing.T) {
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{Routed: true})
+
+	// Share a single signaling session between all clients, in-memory sessions
+	// are not safe for concurrent writes.
+	session, err := xconn.ConnectAnonymous(context.Background(), serveWebSocket(t, signalingRouter), "realm1")
+	require.NoError(t, err)
+
+	const clients = 5
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			_, err := wamp_webrtc_go.ConnectWAMP(wampClientConfig(session))
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < clients; i++ {
+		require.NoError(t, <-errs)
+	}
+}
+
+func TestConnectWebRTCRelayOnly(t *testing.T) {
+	_, offererSignaler, _ := setupMemoryProvider(t, &wamp_webrtc_go.ProviderConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Without any TURN server there is no relay candidate to connect through.
+	_, err := wamp_webrtc_go.ConnectWebRTCContext(ctx, &wamp_webrtc_go.ClientConfig{
+		Realm:              wamp_webrtc_go.DefaultRealm,
+		Serializer:         xconn.CBORSerializerSpec,
+		Signaler:           offererSignaler,
+		ICETransportPolicy: webrtc.ICETransportPolicyRelay,
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
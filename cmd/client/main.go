@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 
+	"github.com/pion/webrtc/v4"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/wamp-webrtc-go"
@@ -14,23 +19,74 @@ const (
 	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
 	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
 	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
+	procedureICEServers      = "io.xconn.webrtc.ice_servers"
 )
 
-func main() {
-	session, err := xconn.ConnectAnonymous(context.Background(), "ws://localhost:8080/ws", "realm1")
-	if err != nil {
-		log.Fatal("Failed to connect to server:", err)
+// urlList collects the values of a flag given multiple times.
+type urlList []string
+
+func (u *urlList) String() string {
+	return strings.Join(*u, ",")
+}
+
+func (u *urlList) Set(value string) error {
+	*u = append(*u, value)
+	return nil
+}
+
+// iceServers returns an ICE server per URL, the credentials only apply to TURN servers.
+func iceServers(urls []string, username, credential string) []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, 0, len(urls))
+	for _, url := range urls {
+		server := webrtc.ICEServer{URLs: []string{url}}
+		if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+			server.Username = username
+			server.Credential = credential
+		}
+
+		servers = append(servers, server)
 	}
 
+	return servers
+}
+
+func main() {
+	manualSignaling := flag.Bool("manual-signaling", false,
+		"exchange offer and answer by copy-paste instead of a WAMP router")
+	var urls urlList
+	flag.Var(&urls, "ice-server", "STUN or TURN server URL, e.g. turn:turn.example.com:3478, may be repeated")
+	turnUsername := flag.String("turn-username", "", "username for the TURN servers")
+	turnCredential := flag.String("turn-credential", "", "credential for the TURN servers")
+	relayOnly := flag.Bool("relay-only", false, "only connect through TURN servers")
+	flag.Parse()
+
 	config := &wamp_webrtc_go.ClientConfig{
-		Realm:                    "realm1",
-		ProcedureWebRTCOffer:     procedureWebRTCOffer,
-		TopicAnswererOnCandidate: topicAnswererOnCandidate,
-		TopicOffererOnCandidate:  topicOffererOnCandidate,
-		Serializer:               xconn.CBORSerializerSpec,
-		Authenticator:            auth.NewWAMPCRAAuthenticator("john", "hello", map[string]any{}),
-		Session:                  session,
+		Realm:         "realm1",
+		Serializer:    xconn.CBORSerializerSpec,
+		Authenticator: auth.NewWAMPCRAAuthenticator("john", "hello", map[string]any{}),
+		ICEServers:    iceServers(urls, *turnUsername, *turnCredential),
+	}
+
+	if *relayOnly {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
 	}
+
+	if *manualSignaling {
+		_, _ = fmt.Fprintln(os.Stderr, "Paste the offer below into the provider, then paste its answer here:")
+		config.Signaler = wamp_webrtc_go.NewManualOffererSignaler(os.Stdin, os.Stdout)
+	} else {
+		session, err := xconn.ConnectAnonymous(context.Background(), "ws://localhost:8080/ws", "realm1")
+		if err != nil {
+			log.Fatal("Failed to connect to server:", err)
+		}
+
+		config.Session = session
+		config.ProcedureWebRTCOffer = procedureWebRTCOffer
+		config.TopicAnswererOnCandidate = topicAnswererOnCandidate
+		config.TopicOffererOnCandidate = topicOffererOnCandidate
+		config.ProcedureICEServers = procedureICEServers
+	}
+
 	webRTCSession, err := wamp_webrtc_go.ConnectWebRTC(config)
 	if err != nil {
 		log.Fatal(err)
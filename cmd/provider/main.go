@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 
+	"github.com/pion/webrtc/v4"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/wamp-webrtc-go"
@@ -18,6 +20,7 @@ const (
 	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
 	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
 	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
+	procedureICEServers      = "io.xconn.webrtc.ice_servers"
 
 	testRealm     = "realm1"
 	testSecret    = "hello"
@@ -81,21 +84,47 @@ func (a *Authenticator) Authenticate(request auth.Request) (auth.Response, error
 }
 
 func main() {
-	session, err := xconn.ConnectAnonymous(context.Background(), "ws://localhost:8080/ws", "realm1")
-	if err != nil {
-		log.Fatal("Failed to connect to server:", err)
+	manualSignaling := flag.Bool("manual-signaling", false,
+		"exchange offer and answer by copy-paste instead of a WAMP router")
+	defaultICEServers := flag.Bool("default-ice-servers", false, "gather candidates through public STUN servers")
+	turnServer := flag.String("turn-server", "", "TURN server URL handed out to clients, e.g. turn:turn.example.com:3478")
+	turnSecret := flag.String("turn-secret", "", "shared secret to mint TURN credentials with")
+	flag.Parse()
+
+	// Clients are attached to the built-in router, a non-routed provider would need OnSession.
+	cfg := &wamp_webrtc_go.ProviderConfig{
+		Serializer:           &serializers.CBORSerializer{},
+		Routed:               true,
+		Authenticator:        NewAuthenticator(),
+		UseDefaultICEServers: *defaultICEServers,
+		TURNSecret:           *turnSecret,
 	}
 
-	webRtcManager := wamp_webrtc_go.NewWebRTCHandler()
-	cfg := &wamp_webrtc_go.ProviderConfig{
-		Session:                     session,
-		ProcedureHandleOffer:        procedureWebRTCOffer,
-		TopicHandleRemoteCandidates: topicAnswererOnCandidate,
-		TopicPublishLocalCandidate:  topicOffererOnCandidate,
-		Serializer:                  &serializers.CBORSerializer{},
-		Authenticator:               NewAuthenticator(),
+	if *turnServer != "" {
+		cfg.IceServers = []webrtc.ICEServer{{URLs: []string{*turnServer}}}
 	}
+
+	var done <-chan struct{}
+	if *manualSignaling {
+		_, _ = fmt.Fprintln(os.Stderr, "Paste the offer of the client here, then paste the answer below into it:")
+		cfg.Signaler = wamp_webrtc_go.NewManualAnswererSignaler(os.Stdin, os.Stdout)
+	} else {
+		session, err := xconn.ConnectAnonymous(context.Background(), "ws://localhost:8080/ws", "realm1")
+		if err != nil {
+			log.Fatal("Failed to connect to server:", err)
+		}
+
+		cfg.Session = session
+		cfg.ProcedureHandleOffer = procedureWebRTCOffer
+		cfg.TopicHandleRemoteCandidates = topicAnswererOnCandidate
+		cfg.TopicPublishLocalCandidate = topicOffererOnCandidate
+		cfg.ProcedureICEServers = procedureICEServers
+		done = session.Done()
+	}
+
+	webRtcManager := wamp_webrtc_go.NewWebRTCHandler()
 	webRtcManager.Setup(cfg)
+	defer func() { _ = webRtcManager.Close() }()
 
 	// Close server if SIGINT (CTRL-c) received.
 	closeChan := make(chan os.Signal, 1)
@@ -103,6 +132,6 @@ func main() {
 
 	select {
 	case <-closeChan:
-	case <-session.Done():
+	case <-done:
 	}
 }
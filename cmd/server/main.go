@@ -14,6 +14,13 @@ func main() {
 	if err := r.AddRealm("realm1"); err != nil {
 		log.Fatal(err)
 	}
+	// The provider binds WebRTC requests to the session that made the offer.
+	if err := r.AutoDiscloseCaller("realm1", true); err != nil {
+		log.Fatal(err)
+	}
+	if err := r.AutoDisclosePublisher("realm1", true); err != nil {
+		log.Fatal(err)
+	}
 	defer r.Close()
 
 	server := xconn.NewServer(r, nil, nil)
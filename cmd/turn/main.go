@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/xconnio/wamp-webrtc-go"
+)
+
+func main() {
+	listenAddress := flag.String("listen", "0.0.0.0:3478", "UDP address to listen on")
+	publicIP := flag.String("public-ip", "",
+		"IP address relayed traffic is announced with, required unless -listen has a specific IP")
+	realm := flag.String("realm", wamp_webrtc_go.DefaultTURNRealm, "realm of the TURN server")
+	users := flag.String("users", "", "static credentials as comma separated username=password pairs")
+	secret := flag.String("secret", "", "shared secret of TURN REST credentials, see the provider's -turn-secret")
+	flag.Parse()
+
+	config := &wamp_webrtc_go.TURNServerConfig{
+		ListenAddress: *listenAddress,
+		Realm:         *realm,
+		Users:         map[string]string{},
+		Secret:        *secret,
+	}
+
+	if *publicIP != "" {
+		config.RelayIP = net.ParseIP(*publicIP)
+		if config.RelayIP == nil {
+			log.Fatalf("invalid public IP: %s", *publicIP)
+		}
+	} else if host, _, err := net.SplitHostPort(*listenAddress); err == nil {
+		// Clients can't be told to relay through an unspecified address such as the default 0.0.0.0.
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			log.Fatalf("-public-ip is required when listening on %s", *listenAddress)
+		}
+	}
+
+	for _, user := range strings.Split(*users, ",") {
+		if user == "" {
+			continue
+		}
+
+		username, password, found := strings.Cut(user, "=")
+		if !found {
+			log.Fatalf("invalid user %q, expected username=password", user)
+		}
+
+		config.Users[username] = password
+	}
+
+	server, err := wamp_webrtc_go.NewTURNServer(config)
+	if err != nil {
+		log.Fatal("Failed to start TURN server:", err)
+	}
+	defer func() { _ = server.Close() }()
+
+	log.Printf("TURN server listening on %s", server.Addr())
+
+	// Close server if SIGINT (CTRL-c) received.
+	closeChan := make(chan os.Signal, 1)
+	signal.Notify(closeChan, os.Interrupt)
+	<-closeChan
+}
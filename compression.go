@@ -0,0 +1,149 @@
+package wamp_webrtc_go
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/xconnio/xconn-go"
+)
+
+// Compression is a per-message compression algorithm. Offers list the algorithms their
+// sender decompresses, the answer carries the one picked, if any.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	// CompressionDeflate compresses messages with raw deflate, see RFC 1951.
+	CompressionDeflate Compression = "deflate"
+)
+
+// CompressionStats counts the messages a peer sent compressed, the compression ratio is
+// CompressedBytes / Bytes.
+type CompressionStats struct {
+	Messages        uint64
+	Bytes           uint64
+	CompressedBytes uint64
+}
+
+// Ratio returns the size of the compressed messages relative to their original size.
+func (s CompressionStats) Ratio() float64 {
+	if s.Bytes == 0 {
+		return 1
+	}
+
+	return float64(s.CompressedBytes) / float64(s.Bytes)
+}
+
+// supportedCompressions lists the algorithms this package decompresses.
+func supportedCompressions() []Compression {
+	return []Compression{CompressionDeflate}
+}
+
+// negotiateCompression picks the compression to use with a peer that decompresses the
+// remote algorithms, legacy framing has no room to flag compressed messages.
+func negotiateCompression(framing FramingVersion, remote []Compression) Compression {
+	if framing == FramingLegacy {
+		return CompressionNone
+	}
+
+	for _, compression := range supportedCompressions() {
+		if slices.Contains(remote, compression) {
+			return compression
+		}
+	}
+
+	return CompressionNone
+}
+
+// SetCompression compresses outgoing messages of at least threshold bytes, compression must
+// have been negotiated with the remote peer. Received compressed messages are only accepted
+// once compression is set.
+func (m *WebRTCMessageAssembler) SetCompression(compression Compression, threshold int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.compression = compression
+	m.compressionThreshold = threshold
+}
+
+// CompressionStats returns the counters of the messages sent compressed.
+func (m *WebRTCMessageAssembler) CompressionStats() CompressionStats {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.compressionStats
+}
+
+// compress returns the compressed message if compression is enabled and makes it smaller.
+func (m *WebRTCMessageAssembler) compress(message []byte) ([]byte, bool) {
+	m.Lock()
+	compression, threshold := m.compression, m.compressionThreshold
+	m.Unlock()
+
+	if compression != CompressionDeflate || threshold <= 0 || len(message) < threshold {
+		return message, false
+	}
+
+	var compressed bytes.Buffer
+	writer, _ := m.compressors.Get().(*flate.Writer)
+	if writer == nil {
+		// Favour throughput, structured payloads compress well at any level.
+		writer, _ = flate.NewWriter(&compressed, flate.BestSpeed)
+	} else {
+		writer.Reset(&compressed)
+	}
+	defer m.compressors.Put(writer)
+
+	if _, err := writer.Write(message); err != nil {
+		return message, false
+	}
+
+	if err := writer.Close(); err != nil || compressed.Len() >= len(message) {
+		return message, false
+	}
+
+	m.Lock()
+	m.compressionStats.Messages++
+	m.compressionStats.Bytes += uint64(len(message))
+	m.compressionStats.CompressedBytes += uint64(compressed.Len())
+	m.Unlock()
+
+	return compressed.Bytes(), true
+}
+
+// decompress inflates a received message, it is called with the lock held.
+func (m *WebRTCMessageAssembler) decompress(message []byte) ([]byte, error) {
+	if m.compression == CompressionNone {
+		return nil, fmt.Errorf("%w: compression was not negotiated", ErrMalformedFrame)
+	}
+
+	if m.decompressor == nil {
+		m.decompressor = flate.NewReader(bytes.NewReader(message))
+	} else if err := m.decompressor.(flate.Resetter).Reset(bytes.NewReader(message), nil); err != nil {
+		return nil, err
+	}
+
+	decompressed, err := io.ReadAll(io.LimitReader(m.decompressor, int64(m.maxMessageSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedFrame, err)
+	}
+
+	if len(decompressed) > m.maxMessageSize {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrMessageTooLarge, m.maxMessageSize)
+	}
+
+	return decompressed, nil
+}
+
+// CompressionStatsOf returns the compression counters of a session accepted over WebRTC.
+func CompressionStatsOf(base xconn.BaseSession) (CompressionStats, bool) {
+	conn, ok := base.NetConn().(*peerConn)
+	if !ok {
+		return CompressionStats{}, false
+	}
+
+	return conn.peer.CompressionStats(), true
+}
@@ -0,0 +1,215 @@
+package wamp_webrtc_go
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// dataChannelConnReadSize fits the largest message pion accepts by default.
+const dataChannelConnReadSize = 64 * 1024
+
+// DataChannelConn is a net.Conn over a detached data channel, the byte stream is sent as a
+// sequence of data channel messages of up to WebRTCSession.ChunkSize bytes. The peer
+// connection must have been created with DetachDataChannels set in its OfferConfig or
+// AnswerConfig.
+type DataChannelConn struct {
+	session  *WebRTCSession
+	detached io.ReadWriteCloser
+
+	readLock sync.Mutex
+	readBuf  []byte
+	pending  []byte
+
+	writeLock       sync.Mutex
+	messageSize     int
+	writeDeadline   atomic.Pointer[time.Time]
+	deadlineChanged chan struct{}
+	bufferLow       chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDataChannelConn waits for the data channel of the session to open and detaches it.
+func NewDataChannelConn(ctx context.Context, webRTCSession *WebRTCSession) (*DataChannelConn, error) {
+	// Channels handed out by an Offerer are open already, registering another OnOpen handler
+	// would race with the running one inside pion.
+	if webRTCSession.Channel.ReadyState() != webrtc.DataChannelStateOpen {
+		opened := make(chan struct{})
+		var once sync.Once
+		webRTCSession.Channel.OnOpen(func() {
+			once.Do(func() { close(opened) })
+		})
+
+		select {
+		case <-opened:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	detached, err := webRTCSession.Channel.Detach()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &DataChannelConn{
+		session:         webRTCSession,
+		detached:        detached,
+		readBuf:         make([]byte, dataChannelConnReadSize),
+		messageSize:     webRTCSession.ChunkSize(),
+		deadlineChanged: make(chan struct{}, 1),
+		bufferLow:       make(chan struct{}, 1),
+		closed:          make(chan struct{}),
+	}
+	conn.writeDeadline.Store(&time.Time{})
+
+	webRTCSession.Channel.SetBufferedAmountLowThreshold(DefaultLowWatermark)
+	webRTCSession.Channel.OnBufferedAmountLow(func() {
+		select {
+		case conn.bufferLow <- struct{}{}:
+		default:
+		}
+	})
+
+	return conn, nil
+}
+
+func (c *DataChannelConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.pending) == 0 {
+		n, err := c.detached.Read(c.readBuf)
+		if err != nil {
+			return 0, err
+		}
+
+		c.pending = c.readBuf[:n]
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+func (c *DataChannelConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	written := 0
+	for written < len(b) {
+		if err := c.waitWritable(); err != nil {
+			return written, err
+		}
+
+		end := min(written+c.messageSize, len(b))
+		n, err := c.detached.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// waitWritable blocks while the send buffer is above the high watermark or until the
+// write deadline passes.
+func (c *DataChannelConn) waitWritable() error {
+	for {
+		select {
+		case <-c.closed:
+			return net.ErrClosed
+		default:
+		}
+
+		deadline := *c.writeDeadline.Load()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return os.ErrDeadlineExceeded
+		}
+
+		if c.session.Channel.BufferedAmount() <= DefaultHighWatermark {
+			return nil
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		select {
+		case <-c.bufferLow:
+		case <-c.deadlineChanged:
+		case <-c.closed:
+		case <-timeout:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Close closes the data channel, the peer connection is left open for other channels.
+func (c *DataChannelConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.detached.Close()
+	})
+
+	return err
+}
+
+func (c *DataChannelConn) LocalAddr() net.Addr {
+	if details, err := c.session.Details(); err == nil {
+		return details.LocalAddr()
+	}
+
+	return peerAddr(c.session.Channel.Label())
+}
+
+func (c *DataChannelConn) RemoteAddr() net.Addr {
+	if details, err := c.session.Details(); err == nil {
+		return details.RemoteAddr()
+	}
+
+	return peerAddr(c.session.Channel.Label())
+}
+
+func (c *DataChannelConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.SetWriteDeadline(t))
+}
+
+func (c *DataChannelConn) SetReadDeadline(t time.Time) error {
+	deadliner, ok := c.detached.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	return deadliner.SetReadDeadline(t)
+}
+
+// SetWriteDeadline bounds how long a Write waits for the send buffer to drain.
+func (c *DataChannelConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Store(&t)
+
+	select {
+	case c.deadlineChanged <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
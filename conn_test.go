@@ -0,0 +1,100 @@
+package wamp_webrtc_go_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+)
+
+func connectDetached(t *testing.T) (*wamp_webrtc_go.DataChannelConn, *wamp_webrtc_go.DataChannelConn) {
+	offererSignaler, answererSignaler := newMemorySignalerPair()
+	offerer, answerer := wamp_webrtc_go.NewOfferer(), wamp_webrtc_go.NewAnswerer()
+	t.Cleanup(func() {
+		_ = offerer.Close()
+		_ = answerer.Close()
+	})
+
+	addCandidate := func(add func(webrtc.ICECandidateInit) error) wamp_webrtc_go.CandidateHandler {
+		return func(_ string, candidate *webrtc.ICECandidateInit) {
+			if candidate != nil {
+				_ = add(*candidate)
+			}
+		}
+	}
+	require.NoError(t, offererSignaler.OnCandidate(addCandidate(offerer.AddICECandidate)))
+	require.NoError(t, answererSignaler.OnCandidate(addCandidate(answerer.AddICECandidate)))
+	answerer.OnIceCandidate(func(candidate *webrtc.ICECandidate) {
+		var init *webrtc.ICECandidateInit
+		if candidate != nil {
+			candidateInit := candidate.ToJSON()
+			init = &candidateInit
+		}
+		_ = answererSignaler.SendCandidate("request", init)
+	})
+
+	offer, err := offerer.Offer(&wamp_webrtc_go.OfferConfig{Ordered: true, DetachDataChannels: true},
+		offererSignaler, "request")
+	require.NoError(t, err)
+
+	answer, err := answerer.Answer(&wamp_webrtc_go.AnswerConfig{DetachDataChannels: true}, *offer,
+		100*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, offerer.HandleAnswer(*answer))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	newConn := func(channel *webrtc.DataChannel, connection *webrtc.PeerConnection) *wamp_webrtc_go.DataChannelConn {
+		conn, err := wamp_webrtc_go.NewDataChannelConn(ctx, &wamp_webrtc_go.WebRTCSession{
+			Connection: connection,
+			Channel:    channel,
+		})
+		require.NoError(t, err)
+
+		return conn
+	}
+
+	local := newConn(<-offerer.WaitReady(), offerer.Connection())
+	remote := newConn(<-answerer.WaitReady(), answerer.Connection())
+
+	return local, remote
+}
+
+func TestDataChannelConn(t *testing.T) {
+	local, remote := connectDetached(t)
+
+	// Larger than a single data channel message.
+	payload := make([]byte, 100*1024)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	go func() {
+		_, _ = local.Write(payload)
+	}()
+
+	received := make([]byte, len(payload))
+	_, err := io.ReadFull(remote, received)
+	require.NoError(t, err)
+	require.Equal(t, payload, received)
+
+	require.IsType(t, &net.UDPAddr{}, remote.RemoteAddr())
+	require.Equal(t, local.LocalAddr().String(), remote.RemoteAddr().String())
+
+	require.NoError(t, remote.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = remote.Read(received)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	require.NoError(t, remote.SetReadDeadline(time.Time{}))
+	require.NoError(t, local.Close())
+	_, err = remote.Read(received)
+	require.ErrorIs(t, err, io.EOF)
+}
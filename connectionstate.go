@@ -0,0 +1,54 @@
+package wamp_webrtc_go
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// connectionStates fans the state changes of a peer connection out to several callbacks, pion
+// only keeps a single handler.
+type connectionStates struct {
+	callbacks []func(state webrtc.PeerConnectionState)
+
+	sync.Mutex
+}
+
+// watchConnectionStates takes the OnConnectionStateChange handler of connection, callbacks
+// are added to the returned connectionStates.
+func watchConnectionStates(connection *webrtc.PeerConnection) *connectionStates {
+	states := &connectionStates{}
+	connection.OnConnectionStateChange(states.changed)
+
+	return states
+}
+
+func (c *connectionStates) add(callback func(state webrtc.PeerConnectionState)) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.callbacks = append(c.callbacks, callback)
+}
+
+func (c *connectionStates) changed(state webrtc.PeerConnectionState) {
+	c.Lock()
+	callbacks := c.callbacks
+	c.Unlock()
+
+	for _, callback := range callbacks {
+		callback(state)
+	}
+}
+
+// OnConnectionStateChange adds a callback for the state changes of the peer connection.
+// Sessions created by this package rely on the OnConnectionStateChange handler of their
+// Connection, replacing it stops the WebRTCPeer and the provider from noticing a failed
+// connection. A session created by hand hands the callback to the Connection instead.
+func (w *WebRTCSession) OnConnectionStateChange(callback func(state webrtc.PeerConnectionState)) {
+	if w.states == nil {
+		w.Connection.OnConnectionStateChange(callback)
+		return
+	}
+
+	w.states.add(callback)
+}
@@ -0,0 +1,118 @@
+package wamp_webrtc_go
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/xconnio/xconn-go"
+)
+
+// TransportWebRTC identifies peers connected over a WebRTC data channel, it is kept well
+// outside the range of transport types defined by xconn.
+const TransportWebRTC xconn.TransportType = 100
+
+// ConnectionDetails describes the WebRTC connection a session runs over.
+type ConnectionDetails struct {
+	Label             string
+	Protocol          string
+	LocalCandidate    *webrtc.ICECandidate
+	RemoteCandidate   *webrtc.ICECandidate
+	RemoteFingerprint string
+}
+
+// Relayed reports whether the traffic goes through a TURN server rather than directly to the remote peer.
+func (d *ConnectionDetails) Relayed() bool {
+	return d.LocalCandidate.Typ == webrtc.ICECandidateTypeRelay || d.RemoteCandidate.Typ == webrtc.ICECandidateTypeRelay
+}
+
+// LocalAddr returns the address of the local candidate in use.
+func (d *ConnectionDetails) LocalAddr() net.Addr {
+	return candidateAddr(d.LocalCandidate)
+}
+
+// RemoteAddr returns the address of the remote candidate in use.
+func (d *ConnectionDetails) RemoteAddr() net.Addr {
+	return candidateAddr(d.RemoteCandidate)
+}
+
+func (d *ConnectionDetails) String() string {
+	return fmt.Sprintf("%s %s -> %s %s (label=%s, protocol=%s)", d.LocalCandidate.Typ, d.LocalAddr(),
+		d.RemoteCandidate.Typ, d.RemoteAddr(), d.Label, d.Protocol)
+}
+
+// Details returns the details of the established connection.
+func (w *WebRTCSession) Details() (*ConnectionDetails, error) {
+	dtlsTransport := w.Connection.SCTP().Transport()
+	pair, err := dtlsTransport.ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return nil, err
+	}
+
+	if pair == nil {
+		return nil, fmt.Errorf("no ice candidate pair selected yet")
+	}
+
+	details := &ConnectionDetails{
+		Label:           w.Channel.Label(),
+		Protocol:        w.Channel.Protocol(),
+		LocalCandidate:  pair.Local,
+		RemoteCandidate: pair.Remote,
+	}
+
+	if certificate := dtlsTransport.GetRemoteCertificate(); len(certificate) > 0 {
+		details.RemoteFingerprint = fingerprint(certificate)
+	}
+
+	return details, nil
+}
+
+// ChunkSize returns the largest data channel message both peers handle, as advertised by
+// the remote peer. The size every browser accepts applies until the remote description is known.
+func (w *WebRTCSession) ChunkSize() int {
+	if w.Connection == nil || w.Connection.RemoteDescription() == nil {
+		return minChunkSize
+	}
+
+	return negotiateChunkSize(w.Connection.RemoteDescription().SDP)
+}
+
+// ConnectionDetailsOf returns the connection details of a session accepted over WebRTC,
+// e.g. for use in an authorizer.
+func ConnectionDetailsOf(base xconn.BaseSession) (*ConnectionDetails, bool) {
+	conn, ok := base.NetConn().(*peerConn)
+	if !ok {
+		return nil, false
+	}
+
+	details, err := conn.peer.Details()
+	if err != nil {
+		return nil, false
+	}
+
+	return details, true
+}
+
+// fingerprint formats a DER encoded certificate the way it is advertised in SDP.
+func fingerprint(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+
+	hexBytes := make([]string, len(sum))
+	for i, b := range sum {
+		hexBytes[i] = fmt.Sprintf("%02X", b)
+	}
+
+	return "sha-256 " + strings.Join(hexBytes, ":")
+}
+
+func candidateAddr(candidate *webrtc.ICECandidate) net.Addr {
+	ip := net.ParseIP(candidate.Address)
+	if candidate.Protocol == webrtc.ICEProtocolTCP {
+		return &net.TCPAddr{IP: ip, Port: int(candidate.Port)}
+	}
+
+	return &net.UDPAddr{IP: ip, Port: int(candidate.Port)}
+}
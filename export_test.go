@@ -0,0 +1,18 @@
+package wamp_webrtc_go
+
+import "time"
+
+var NegotiateChunkSize = negotiateChunkSize
+
+// AnswererCount returns the number of requests the provider keeps an answerer for.
+func (r *WebRTCProvider) AnswererCount() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.answerers)
+}
+
+// DropOrphans runs the orphan reaper once.
+func (r *WebRTCProvider) DropOrphans(maxAge time.Duration) {
+	r.dropOrphans(maxAge)
+}
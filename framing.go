@@ -0,0 +1,194 @@
+package wamp_webrtc_go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FramingVersion is the chunk header format spoken on a data channel. Peers advertise the
+// highest version they support in their offer or answer and use the lower of both.
+type FramingVersion uint8
+
+const (
+	// FramingLegacy prefixes every chunk with a single byte, 1 for the final chunk of a
+	// message and 0 otherwise.
+	FramingLegacy FramingVersion = 0
+	// FramingVersion1 prefixes every chunk with a header byte 1vvvffff: the high bit tells
+	// it apart from legacy headers, vvv is the version and ffff are the frame flags.
+	FramingVersion1 FramingVersion = 1
+	// FramingVersion2 is version 1 plus message IDs: chunks of a message spanning several
+	// chunks carry the message ID as uvarint after the header byte, so chunks of different
+	// messages can be interleaved.
+	FramingVersion2 FramingVersion = 2
+
+	// SupportedFraming is the highest framing version this package speaks.
+	SupportedFraming = FramingVersion2
+)
+
+const (
+	// minChunkSize is the chunk size every browser accepts.
+	minChunkSize = 16 * 1024
+	// maxChunkSize is the largest message pion receives.
+	maxChunkSize = 64*1024 - 1
+	// defaultRemoteMaxMessageSize applies if the remote doesn't advertise a=max-message-size, see RFC 8841.
+	defaultRemoteMaxMessageSize = 64 * 1024
+	// minFrameSize fits a header byte, the largest message ID and one byte of payload.
+	minFrameSize = 2 + binary.MaxVarintLen64
+
+	frameVersioned    = 0x80
+	frameVersionShift = 4
+	frameVersionMask  = 0x07
+	frameFlagsMask    = 0x0f
+
+	// frameFlagContinuation marks all but the final chunk of a message.
+	frameFlagContinuation = 0x01
+	// frameFlagCompressed marks all chunks of a message whose payload is compressed with
+	// the negotiated Compression.
+	frameFlagCompressed = 0x02
+	// frameFlagMessageID marks a message ID following the header byte.
+	frameFlagMessageID = 0x04
+	frameFlagsReserved = 0x08
+)
+
+type frameHeader struct {
+	version   FramingVersion
+	flags     byte
+	messageID uint64
+}
+
+func (h frameHeader) final() bool {
+	return h.flags&frameFlagContinuation == 0
+}
+
+func (h frameHeader) compressed() bool {
+	return h.flags&frameFlagCompressed != 0
+}
+
+func (h frameHeader) hasMessageID() bool {
+	return h.flags&frameFlagMessageID != 0
+}
+
+// size returns the number of bytes the header takes in a chunk.
+func (h frameHeader) size() int {
+	if !h.hasMessageID() {
+		return 1
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	return 1 + binary.PutUvarint(buf[:], h.messageID)
+}
+
+// encode returns the header byte, legacy headers only carry the continuation flag.
+func (h frameHeader) encode() byte {
+	if h.version == FramingLegacy {
+		if h.final() {
+			return 1
+		}
+
+		return 0
+	}
+
+	return frameVersioned | byte(h.version)<<frameVersionShift | h.flags&frameFlagsMask
+}
+
+// appendTo appends the header byte and the message ID, if any, to dst.
+func (h frameHeader) appendTo(dst []byte) []byte {
+	dst = append(dst, h.encode())
+	if h.hasMessageID() {
+		dst = binary.AppendUvarint(dst, h.messageID)
+	}
+
+	return dst
+}
+
+// parseFrame splits a chunk into its header and payload.
+func parseFrame(data []byte) (frameHeader, []byte, error) {
+	if len(data) == 0 {
+		return frameHeader{}, nil, fmt.Errorf("%w: empty frame", ErrMalformedFrame)
+	}
+
+	header, err := parseFrameHeader(data[0])
+	if err != nil {
+		return frameHeader{}, nil, err
+	}
+
+	payload := data[1:]
+	if header.hasMessageID() {
+		messageID, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return frameHeader{}, nil, fmt.Errorf("%w: invalid message id", ErrMalformedFrame)
+		}
+
+		header.messageID = messageID
+		payload = payload[n:]
+	}
+
+	return header, payload, nil
+}
+
+// parseFrameHeader decodes a header byte of any version, flags this package doesn't
+// implement are rejected. Whether compression was negotiated is up to the caller.
+func parseFrameHeader(header byte) (frameHeader, error) {
+	switch {
+	case header == 0:
+		return frameHeader{version: FramingLegacy, flags: frameFlagContinuation}, nil
+	case header == 1:
+		return frameHeader{version: FramingLegacy}, nil
+	case header&frameVersioned == 0:
+		return frameHeader{}, fmt.Errorf("%w: unknown header %#x", ErrMalformedFrame, header)
+	}
+
+	version := FramingVersion((header >> frameVersionShift) & frameVersionMask)
+	if version == FramingLegacy || version > SupportedFraming {
+		return frameHeader{}, fmt.Errorf("%w: unsupported framing version %d", ErrMalformedFrame, version)
+	}
+
+	flags := header & frameFlagsMask
+	unsupported := byte(frameFlagsReserved)
+	if version < FramingVersion2 {
+		unsupported |= frameFlagMessageID
+	}
+
+	if flags&unsupported != 0 {
+		return frameHeader{}, fmt.Errorf("%w: unsupported flags %#x", ErrMalformedFrame, flags)
+	}
+
+	return frameHeader{version: version, flags: flags}, nil
+}
+
+// negotiateFraming picks the framing version to use with a peer that supports up to remote.
+func negotiateFraming(remote FramingVersion) FramingVersion {
+	return min(remote, SupportedFraming)
+}
+
+// negotiateChunkSize derives the chunk size from the a=max-message-size attribute of the
+// remote SDP, where 0 stands for no limit. The chunk size never exceeds what the remote
+// advertised.
+func negotiateChunkSize(remoteSDP string) int {
+	remoteMaxMessageSize := defaultRemoteMaxMessageSize
+
+	scanner := bufio.NewScanner(strings.NewReader(remoteSDP))
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "a=max-message-size:")
+		if !found {
+			continue
+		}
+
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			break
+		}
+
+		remoteMaxMessageSize = size
+		if size == 0 {
+			remoteMaxMessageSize = maxChunkSize
+		}
+
+		break
+	}
+
+	return min(remoteMaxMessageSize, maxChunkSize)
+}
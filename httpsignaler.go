@@ -0,0 +1,403 @@
+package wamp_webrtc_go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const httpSignalingPollTimeout = 10 * time.Second
+
+// httpRequest holds the local candidates of a request until the offerer polls them.
+type httpRequest struct {
+	candidates []webrtc.ICECandidateInit
+	notify     chan struct{}
+}
+
+// HTTPAnswererSignaler is a WHIP-style signaling endpoint for a provider. It is an
+// http.Handler serving the following routes relative to where it is mounted:
+//
+//	POST /       takes an Offer and responds with the Answer, the Location header
+//	             names the resource created for the request.
+//	PATCH /{id}  takes a candidate trickled by the offerer.
+//	GET /{id}    long-polls the candidates trickled by the provider.
+//
+// Candidates are ICECandidateInit JSON objects, an empty candidate marks the end
+// of candidates.
+type HTTPAnswererSignaler struct {
+	onOffer     OfferHandler
+	onCandidate CandidateHandler
+	requests    map[string]*httpRequest
+
+	sync.Mutex
+}
+
+func NewHTTPAnswererSignaler() *HTTPAnswererSignaler {
+	return &HTTPAnswererSignaler{
+		requests: make(map[string]*httpRequest),
+	}
+}
+
+func (h *HTTPAnswererSignaler) OnOffer(handler OfferHandler) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.onOffer = handler
+	return nil
+}
+
+func (h *HTTPAnswererSignaler) OnCandidate(handler CandidateHandler) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.onCandidate = handler
+	return nil
+}
+
+func (h *HTTPAnswererSignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	h.Lock()
+	defer h.Unlock()
+
+	request, ok := h.requests[requestID]
+	if !ok {
+		return fmt.Errorf("unknown request: %s", requestID)
+	}
+
+	if candidate == nil {
+		candidate = &webrtc.ICECandidateInit{}
+	}
+
+	request.candidates = append(request.candidates, *candidate)
+	select {
+	case request.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (h *HTTPAnswererSignaler) Release(requestID string) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.requests, requestID)
+}
+
+func (h *HTTPAnswererSignaler) Close() error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.requests = make(map[string]*httpRequest)
+	return nil
+}
+
+func (h *HTTPAnswererSignaler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxSignalingMessageSize)
+
+	requestID := strings.Trim(req.URL.Path, "/")
+	switch {
+	case requestID == "" && req.Method == http.MethodPost:
+		h.handleOffer(w, req)
+	case requestID != "" && req.Method == http.MethodPatch:
+		h.handleCandidate(w, req, requestID)
+	case requestID != "" && req.Method == http.MethodGet:
+		h.pollCandidates(w, req, requestID)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *HTTPAnswererSignaler) handleOffer(w http.ResponseWriter, req *http.Request) {
+	var offer Offer
+	if err := json.NewDecoder(req.Body).Decode(&offer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestID := uuid.New().String()
+
+	h.Lock()
+	handler := h.onOffer
+	h.requests[requestID] = &httpRequest{notify: make(chan struct{}, 1)}
+	h.Unlock()
+
+	if handler == nil {
+		h.Release(requestID)
+		http.Error(w, "not accepting offers", http.StatusServiceUnavailable)
+		return
+	}
+
+	answer, err := handler(requestID, &offer)
+	if err != nil {
+		h.Release(requestID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", requestID)
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(answer); err != nil {
+		log.Errorf("failed to write answer: %v", err)
+	}
+}
+
+func (h *HTTPAnswererSignaler) handleCandidate(w http.ResponseWriter, req *http.Request, requestID string) {
+	var candidate webrtc.ICECandidateInit
+	if err := json.NewDecoder(req.Body).Decode(&candidate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.Lock()
+	_, ok := h.requests[requestID]
+	handler := h.onCandidate
+	h.Unlock()
+
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	if handler != nil {
+		if candidate.Candidate == "" {
+			handler(requestID, nil)
+		} else {
+			handler(requestID, &candidate)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPAnswererSignaler) pollCandidates(w http.ResponseWriter, req *http.Request, requestID string) {
+	h.Lock()
+	request, ok := h.requests[requestID]
+	h.Unlock()
+
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	select {
+	case <-request.notify:
+	case <-time.After(httpSignalingPollTimeout):
+	case <-req.Context().Done():
+		return
+	}
+
+	h.Lock()
+	candidates := request.candidates
+	request.candidates = nil
+	h.Unlock()
+
+	if candidates == nil {
+		candidates = []webrtc.ICECandidateInit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(candidates); err != nil {
+		log.Errorf("failed to write candidates: %v", err)
+	}
+}
+
+// HTTPOffererSignaler is the client side of HTTPAnswererSignaler.
+type HTTPOffererSignaler struct {
+	url    string
+	client *http.Client
+
+	onCandidate CandidateHandler
+	resources   map[string]string
+	buffered    map[string][]*webrtc.ICECandidateInit
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sync.Mutex
+}
+
+// NewHTTPOffererSignaler creates a signaler for the endpoint at url. If client is nil
+// http.DefaultClient is used.
+func NewHTTPOffererSignaler(url string, client *http.Client) *HTTPOffererSignaler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPOffererSignaler{
+		url:       strings.TrimSuffix(url, "/"),
+		client:    client,
+		resources: make(map[string]string),
+		buffered:  make(map[string][]*webrtc.ICECandidateInit),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (h *HTTPOffererSignaler) SendOffer(ctx context.Context, requestID string, offer *Offer) (*Answer, error) {
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := h.do(ctx, http.MethodPost, h.url+"/", offerJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusCreated {
+		return nil, responseError(response)
+	}
+
+	var answer Answer
+	if err = json.NewDecoder(response.Body).Decode(&answer); err != nil {
+		return nil, err
+	}
+
+	location := path.Base(response.Header.Get("Location"))
+	if location == "." || location == "/" {
+		return nil, fmt.Errorf("missing request location in answer")
+	}
+	resource := h.url + "/" + location
+
+	h.Lock()
+	h.resources[requestID] = resource
+	buffered := h.buffered[requestID]
+	delete(h.buffered, requestID)
+	h.Unlock()
+
+	for _, candidate := range buffered {
+		if err = h.patchCandidate(resource, candidate); err != nil {
+			return nil, err
+		}
+	}
+
+	go h.poll(requestID, resource)
+
+	return &answer, nil
+}
+
+func (h *HTTPOffererSignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	h.Lock()
+	resource, ok := h.resources[requestID]
+	if !ok {
+		// The resource only exists once the offer was answered.
+		h.buffered[requestID] = append(h.buffered[requestID], candidate)
+	}
+	h.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return h.patchCandidate(resource, candidate)
+}
+
+func (h *HTTPOffererSignaler) patchCandidate(resource string, candidate *webrtc.ICECandidateInit) error {
+	candidateJSON, err := marshalCandidate(candidate)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.do(h.ctx, http.MethodPatch, resource, []byte(candidateJSON))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusNoContent {
+		return responseError(response)
+	}
+
+	return nil
+}
+
+// poll delivers the candidates trickled by the provider until the end of
+// candidates or until the signaler is closed.
+func (h *HTTPOffererSignaler) poll(requestID, resource string) {
+	for {
+		response, err := h.do(h.ctx, http.MethodGet, resource, nil)
+		if err != nil {
+			return
+		}
+
+		var candidates []webrtc.ICECandidateInit
+		if response.StatusCode == http.StatusOK {
+			err = json.NewDecoder(response.Body).Decode(&candidates)
+		} else {
+			err = responseError(response)
+		}
+		_ = response.Body.Close()
+
+		if err != nil {
+			log.Debugf("stopped polling candidates: %v", err)
+			return
+		}
+
+		h.Lock()
+		handler := h.onCandidate
+		h.Unlock()
+
+		for _, candidate := range candidates {
+			if candidate.Candidate == "" {
+				if handler != nil {
+					handler(requestID, nil)
+				}
+				return
+			}
+
+			if handler != nil {
+				handler(requestID, &candidate)
+			}
+		}
+	}
+}
+
+func (h *HTTPOffererSignaler) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return h.client.Do(request)
+}
+
+func (h *HTTPOffererSignaler) OnCandidate(handler CandidateHandler) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.onCandidate = handler
+	return nil
+}
+
+func (h *HTTPOffererSignaler) Close() error {
+	h.cancel()
+	return nil
+}
+
+func responseError(response *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(response.Body, maxSignalingMessageSize))
+	return fmt.Errorf("signaling request failed: %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
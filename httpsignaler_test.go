@@ -0,0 +1,63 @@
+package wamp_webrtc_go_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/xconn-go"
+)
+
+func TestHTTPSignaler(t *testing.T) {
+	signaler := wamp_webrtc_go.NewHTTPAnswererSignaler()
+	provider := wamp_webrtc_go.NewWebRTCHandler()
+	provider.Setup(&wamp_webrtc_go.ProviderConfig{
+		Signaler:   signaler,
+		Serializer: &serializers.CBORSerializer{},
+		Routed:     true,
+	})
+	t.Cleanup(func() { _ = provider.Close() })
+
+	mux := http.NewServeMux()
+	mux.Handle("/webrtc/", http.StripPrefix("/webrtc", signaler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	t.Run("Connect", func(t *testing.T) {
+		session, err := wamp_webrtc_go.ConnectWAMP(&wamp_webrtc_go.ClientConfig{
+			Realm:      wamp_webrtc_go.DefaultRealm,
+			Serializer: xconn.CBORSerializerSpec,
+			Signaler:   wamp_webrtc_go.NewHTTPOffererSignaler(server.URL+"/webrtc", server.Client()),
+		})
+		require.NoError(t, err)
+
+		registerResp := session.Register("io.xconn.echo", echo).Do()
+		require.NoError(t, registerResp.Err)
+
+		callResp := session.Call("io.xconn.echo").Arg("hello").Do()
+		require.NoError(t, callResp.Err)
+		require.Equal(t, "hello", callResp.Args.StringOr(0, ""))
+	})
+
+	t.Run("InvalidOffer", func(t *testing.T) {
+		response, err := server.Client().Post(server.URL+"/webrtc/", "application/json", strings.NewReader("{"))
+		require.NoError(t, err)
+		_ = response.Body.Close()
+		require.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("UnknownRequest", func(t *testing.T) {
+		request, err := http.NewRequest(http.MethodPatch, server.URL+"/webrtc/unknown", strings.NewReader("{}"))
+		require.NoError(t, err)
+
+		response, err := server.Client().Do(request)
+		require.NoError(t, err)
+		_ = response.Body.Close()
+		require.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
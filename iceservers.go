@@ -0,0 +1,146 @@
+package wamp_webrtc_go
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // HMAC-SHA1 is mandated by the TURN REST credential scheme.
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/xconn-go"
+)
+
+const (
+	// DefaultTURNCredentialTTL is how long TURN credentials minted by a provider stay valid.
+	DefaultTURNCredentialTTL = 12 * time.Hour
+
+	// providerTURNAuthID is used for the TURN credentials of a provider without a session.
+	providerTURNAuthID = "provider"
+)
+
+// TURNCredentials mints time-limited credentials for a TURN server sharing secret, as
+// described in draft-uberti-behave-turn-rest. The username carries the expiry and the
+// authid the credentials are bound to.
+func TURNCredentials(secret, authID string, ttl time.Duration) (username, credential string) {
+	username = fmt.Sprintf("%d:%s", time.Now().Add(ttl).Unix(), authID)
+	return username, TURNCredential(secret, username)
+}
+
+// TURNCredential returns the password of a TURN REST username.
+func TURNCredential(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TURNCredentialExpiry returns when a TURN REST username stops being valid.
+func TURNCredentialExpiry(username string) (time.Time, error) {
+	expiry, _, _ := strings.Cut(username, ":")
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid turn username %q", username)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+// withTURNCredentials returns a copy of servers in which TURN servers carry fresh
+// credentials for authID, STUN servers are returned as is.
+func withTURNCredentials(servers []webrtc.ICEServer, secret, authID string, ttl time.Duration) []webrtc.ICEServer {
+	username, credential := TURNCredentials(secret, authID, ttl)
+
+	result := make([]webrtc.ICEServer, 0, len(servers))
+	for _, server := range servers {
+		for _, url := range server.URLs {
+			if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+				server.Username = username
+				server.Credential = credential
+				break
+			}
+		}
+
+		result = append(result, server)
+	}
+
+	return result
+}
+
+// setupTURNCredentials configures the provider to mint TURN credentials, the provider's
+// own credentials are bound to the authid of its session.
+func (r *WebRTCProvider) setupTURNCredentials(config *ProviderConfig) {
+	ttl := config.TURNCredentialTTL
+	if ttl == 0 {
+		ttl = DefaultTURNCredentialTTL
+	}
+
+	authID := providerTURNAuthID
+	if config.Session != nil && config.Session.Details().AuthID() != "" {
+		authID = config.Session.Details().AuthID()
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.turnSecret, r.turnCredentialTTL, r.turnAuthID = config.TURNSecret, ttl, authID
+}
+
+// iceServersFor returns the ICE servers of the provider, TURN servers carry credentials
+// bound to authID if a TURN secret is configured.
+func (r *WebRTCProvider) iceServersFor(authID string) []webrtc.ICEServer {
+	r.Lock()
+	servers, secret, ttl := r.iceServers, r.turnSecret, r.turnCredentialTTL
+	r.Unlock()
+
+	if secret == "" {
+		return servers
+	}
+
+	return withTURNCredentials(servers, secret, authID, ttl)
+}
+
+// handleICEServers answers the ICE servers procedure with the servers of the provider,
+// TURN credentials are bound to the authid of the caller.
+func (r *WebRTCProvider) handleICEServers(invocation *xconn.Invocation) *xconn.InvocationResult {
+	r.Lock()
+	minting := r.turnSecret != ""
+	r.Unlock()
+
+	authID := invocation.CallerAuthID()
+	if minting && authID == "" {
+		return xconn.NewInvocationError(wampproto.ErrNotAuthorized, "caller must be disclosed")
+	}
+
+	serversJSON, err := json.Marshal(r.iceServersFor(authID))
+	if err != nil {
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+	}
+
+	return xconn.NewInvocationResult(string(serversJSON))
+}
+
+// fetchICEServers calls the ICE servers procedure of a provider.
+func fetchICEServers(ctx context.Context, session *xconn.Session, procedure string) ([]webrtc.ICEServer, error) {
+	callResponse := session.Call(procedure).Option("disclose_me", true).DoContext(ctx)
+	if callResponse.Err != nil {
+		return nil, callResponse.Err
+	}
+
+	serversJSON, err := callResponse.Args.String(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []webrtc.ICEServer
+	if err = json.Unmarshal([]byte(serversJSON), &servers); err != nil {
+		return nil, err
+	}
+
+	return servers, nil
+}
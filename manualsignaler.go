@@ -0,0 +1,292 @@
+package wamp_webrtc_go
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const manualGatherTimeout = 10 * time.Second
+
+// EncodeSignal encodes an offer or answer into a compact blob that can be copied
+// between machines by hand.
+func EncodeSignal(signal *Offer) (string, error) {
+	signalJSON, err := json.Marshal(signal)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = writer.Write(signalJSON); err != nil {
+		return "", err
+	}
+
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// DecodeSignal decodes a blob created by EncodeSignal.
+func DecodeSignal(blob string) (*Offer, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(blob))
+	if err != nil {
+		return nil, err
+	}
+
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer func() { _ = reader.Close() }()
+
+	var signal Offer
+	if err = json.NewDecoder(io.LimitReader(reader, maxSignalingMessageSize)).Decode(&signal); err != nil {
+		return nil, err
+	}
+
+	return &signal, nil
+}
+
+// gatheredCandidates collects local candidates until the end of candidates, as
+// manual signaling can't trickle them.
+type gatheredCandidates struct {
+	candidates []webrtc.ICECandidateInit
+	done       chan struct{}
+	doneOnce   sync.Once
+}
+
+func newGatheredCandidates() *gatheredCandidates {
+	return &gatheredCandidates{done: make(chan struct{})}
+}
+
+func (g *gatheredCandidates) add(candidate *webrtc.ICECandidateInit) {
+	if candidate == nil {
+		g.doneOnce.Do(func() { close(g.done) })
+		return
+	}
+
+	g.candidates = append(g.candidates, *candidate)
+}
+
+func readSignal(ctx context.Context, reader *bufio.Reader) (*Offer, error) {
+	type readResult struct {
+		line string
+		err  error
+	}
+
+	results := make(chan readResult, 1)
+	go func() {
+		line, err := reader.ReadString('\n')
+		results <- readResult{line: line, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		if strings.TrimSpace(result.line) == "" && result.err != nil {
+			return nil, result.err
+		}
+
+		return DecodeSignal(result.line)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ManualOffererSignaler writes the offer, including all local candidates, to out and
+// reads the answer from in, one blob per line.
+type ManualOffererSignaler struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	gathered map[string]*gatheredCandidates
+
+	sync.Mutex
+}
+
+func NewManualOffererSignaler(in io.Reader, out io.Writer) *ManualOffererSignaler {
+	return &ManualOffererSignaler{
+		in:       bufio.NewReader(in),
+		out:      out,
+		gathered: make(map[string]*gatheredCandidates),
+	}
+}
+
+func (m *ManualOffererSignaler) candidates(requestID string) *gatheredCandidates {
+	m.Lock()
+	defer m.Unlock()
+
+	gathered, ok := m.gathered[requestID]
+	if !ok {
+		gathered = newGatheredCandidates()
+		m.gathered[requestID] = gathered
+	}
+
+	return gathered
+}
+
+func (m *ManualOffererSignaler) SendOffer(ctx context.Context, requestID string, offer *Offer) (*Answer, error) {
+	gathered := m.candidates(requestID)
+	select {
+	case <-gathered.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	m.Lock()
+	offer.Candidates = append(offer.Candidates, gathered.candidates...)
+	delete(m.gathered, requestID)
+	m.Unlock()
+
+	blob, err := EncodeSignal(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = fmt.Fprintln(m.out, blob); err != nil {
+		return nil, err
+	}
+
+	return readSignal(ctx, m.in)
+}
+
+func (m *ManualOffererSignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	gathered := m.candidates(requestID)
+
+	m.Lock()
+	defer m.Unlock()
+
+	gathered.add(candidate)
+	return nil
+}
+
+// OnCandidate is a no-op, the answer carries all remote candidates.
+func (m *ManualOffererSignaler) OnCandidate(CandidateHandler) error {
+	return nil
+}
+
+func (m *ManualOffererSignaler) Close() error {
+	return nil
+}
+
+// ManualAnswererSignaler reads offers from in and writes the answers, including all
+// local candidates, to out, one blob per line.
+type ManualAnswererSignaler struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	gathered map[string]*gatheredCandidates
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	sync.Mutex
+}
+
+func NewManualAnswererSignaler(in io.Reader, out io.Writer) *ManualAnswererSignaler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ManualAnswererSignaler{
+		in:       bufio.NewReader(in),
+		out:      out,
+		gathered: make(map[string]*gatheredCandidates),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (m *ManualAnswererSignaler) OnOffer(handler OfferHandler) error {
+	go func() {
+		for {
+			offer, err := readSignal(m.ctx, m.in)
+			if err != nil {
+				if m.ctx.Err() == nil {
+					log.Errorf("failed to read offer: %v", err)
+				}
+				return
+			}
+
+			if err = m.answer(offer, handler); err != nil {
+				log.Errorf("failed to answer offer: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (m *ManualAnswererSignaler) answer(offer *Offer, handler OfferHandler) error {
+	requestID := uuid.New().String()
+	gathered := newGatheredCandidates()
+
+	m.Lock()
+	m.gathered[requestID] = gathered
+	m.Unlock()
+
+	defer func() {
+		m.Lock()
+		delete(m.gathered, requestID)
+		m.Unlock()
+	}()
+
+	answer, err := handler(requestID, offer)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-gathered.done:
+	case <-time.After(manualGatherTimeout):
+		log.Warnf("candidate gathering didn't complete after %s", manualGatherTimeout)
+	}
+
+	m.Lock()
+	answer.Candidates = append(answer.Candidates, gathered.candidates...)
+	m.Unlock()
+
+	blob, err := EncodeSignal(answer)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(m.out, blob)
+	return err
+}
+
+func (m *ManualAnswererSignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	m.Lock()
+	defer m.Unlock()
+
+	gathered, ok := m.gathered[requestID]
+	if !ok {
+		return fmt.Errorf("unknown request: %s", requestID)
+	}
+
+	gathered.add(candidate)
+	return nil
+}
+
+// OnCandidate is a no-op, the offer carries all remote candidates.
+func (m *ManualAnswererSignaler) OnCandidate(CandidateHandler) error {
+	return nil
+}
+
+func (m *ManualAnswererSignaler) Release(string) {}
+
+func (m *ManualAnswererSignaler) Close() error {
+	m.cancel()
+	return nil
+}
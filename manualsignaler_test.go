@@ -0,0 +1,57 @@
+package wamp_webrtc_go_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/xconn-go"
+)
+
+func TestManualSignaler(t *testing.T) {
+	offerReader, offerWriter := io.Pipe()
+	answerReader, answerWriter := io.Pipe()
+
+	provider := wamp_webrtc_go.NewWebRTCHandler()
+	provider.Setup(&wamp_webrtc_go.ProviderConfig{
+		Signaler:   wamp_webrtc_go.NewManualAnswererSignaler(offerReader, answerWriter),
+		Serializer: &serializers.CBORSerializer{},
+		Routed:     true,
+	})
+	t.Cleanup(func() { _ = provider.Close() })
+
+	session, err := wamp_webrtc_go.ConnectWAMP(&wamp_webrtc_go.ClientConfig{
+		Realm:      wamp_webrtc_go.DefaultRealm,
+		Serializer: xconn.CBORSerializerSpec,
+		Signaler:   wamp_webrtc_go.NewManualOffererSignaler(answerReader, offerWriter),
+	})
+	require.NoError(t, err)
+
+	registerResp := session.Register("io.xconn.echo", echo).Do()
+	require.NoError(t, registerResp.Err)
+
+	callResp := session.Call("io.xconn.echo").Arg("hello").Do()
+	require.NoError(t, callResp.Err)
+	require.Equal(t, "hello", callResp.Args.StringOr(0, ""))
+}
+
+func TestSignalEncoding(t *testing.T) {
+	offer := &wamp_webrtc_go.Offer{
+		Description: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0"},
+		Candidates:  []webrtc.ICECandidateInit{{Candidate: "candidate:1 1 udp 1 127.0.0.1 5000 typ host"}},
+	}
+
+	blob, err := wamp_webrtc_go.EncodeSignal(offer)
+	require.NoError(t, err)
+
+	decoded, err := wamp_webrtc_go.DecodeSignal(blob + "\n")
+	require.NoError(t, err)
+	require.Equal(t, offer, decoded)
+
+	_, err = wamp_webrtc_go.DecodeSignal("not a signal")
+	require.Error(t, err)
+}
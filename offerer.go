@@ -1,50 +1,51 @@
 package wamp_webrtc_go
 
 import (
-	"encoding/json"
+	"sync"
 
 	"github.com/pion/webrtc/v4"
 	log "github.com/sirupsen/logrus"
-
-	"github.com/xconnio/xconn-go"
 )
 
 type Offerer struct {
 	connection *webrtc.PeerConnection
 	channel    chan *webrtc.DataChannel
+	failed     chan struct{}
+	failedOnce sync.Once
+	framing    FramingVersion
+	states     *connectionStates
+
+	compression Compression
 }
 
 func NewOfferer() *Offerer {
 	return &Offerer{
 		channel: make(chan *webrtc.DataChannel, 1),
+		failed:  make(chan struct{}),
 	}
 }
 
-func (o *Offerer) Offer(offerConfig *OfferConfig, session *xconn.Session, requestID string) (*Offer, error) {
+func (o *Offerer) Offer(offerConfig *OfferConfig, signaler Signaler, requestID string) (*Offer, error) {
 	// Prepare the configuration
 	config := webrtc.Configuration{
-		ICEServers: offerConfig.ICEServers,
+		ICEServers:         offerConfig.ICEServers,
+		ICETransportPolicy: offerConfig.ICETransportPolicy,
 	}
 
 	// Create a new RTCPeerConnection
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	peerConnection, err := newPeerConnection(config, offerConfig.SettingEngine, offerConfig.DetachDataChannels)
 	if err != nil {
 		return nil, err
 	}
 
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-		if candidate != nil {
-			answerData, err := json.Marshal(candidate.ToJSON())
-			if err != nil {
-				log.Errorf("failed to marshal answer: %v", err)
-				return
-			}
-
-			_ = session.Publish(offerConfig.TopicAnswererOnCandidate).Args(requestID, string(answerData)).Do()
+		if err := signaler.SendCandidate(requestID, candidateInit(candidate)); err != nil {
+			log.Errorf("failed to send candidate: %v", err)
 		}
 	})
 
 	o.connection = peerConnection
+	o.states = watchConnectionStates(peerConnection)
 
 	options := &webrtc.DataChannelInit{
 		Ordered:  &offerConfig.Ordered,
@@ -62,8 +63,11 @@ func (o *Offerer) Offer(offerConfig *OfferConfig, session *xconn.Session, reques
 
 	// Set the handler for Peer connection state
 	// This will notify you when the peer has connected/disconnected
-	peerConnection.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+	o.states.add(func(s webrtc.PeerConnectionState) {
 		log.Debugf("Peer Connection State has changed: %s\n", s.String())
+		if s == webrtc.PeerConnectionStateFailed {
+			o.failedOnce.Do(func() { close(o.failed) })
+		}
 	})
 
 	// Create a new offer
@@ -79,11 +83,15 @@ func (o *Offerer) Offer(offerConfig *OfferConfig, session *xconn.Session, reques
 	}
 
 	return &Offer{
+		Framing:     SupportedFraming,
+		Compression: supportedCompressions(),
 		Description: offer,
 	}, nil
 }
 
 func (o *Offerer) HandleAnswer(answer Answer) error {
+	o.framing = negotiateFraming(answer.Framing)
+	o.compression = negotiateCompression(o.framing, answer.Compression)
 	if err := o.connection.SetRemoteDescription(answer.Description); err != nil {
 		return err
 	}
@@ -101,6 +109,28 @@ func (o *Offerer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
 	return o.connection.AddICECandidate(candidate)
 }
 
+// Framing returns the framing version agreed on with the answerer.
+func (o *Offerer) Framing() FramingVersion {
+	return o.framing
+}
+
+// Compression returns the message compression agreed on with the answerer.
+func (o *Offerer) Compression() Compression {
+	return o.compression
+}
+
+func (o *Offerer) Connection() *webrtc.PeerConnection {
+	return o.connection
+}
+
 func (o *Offerer) WaitReady() chan *webrtc.DataChannel {
 	return o.channel
 }
+
+func (o *Offerer) Close() error {
+	if o.connection == nil {
+		return nil
+	}
+
+	return o.connection.Close()
+}
@@ -1,57 +1,357 @@
 package wamp_webrtc_go
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/pion/webrtc/v4"
 
 	"github.com/xconnio/xconn-go"
 )
 
+const (
+	// closeFlushTimeout bounds how long Close waits for queued messages to reach the remote peer.
+	closeFlushTimeout = time.Second
+
+	DefaultHighWatermark = 1 << 20
+	DefaultLowWatermark  = DefaultHighWatermark / 4
+)
+
+var (
+	ErrConnectionFailed  = errors.New("webrtc connection failed")
+	ErrBufferFull        = errors.New("webrtc send buffer is full")
+	ErrProtocolViolation = errors.New("webrtc protocol violation")
+)
+
+// BackpressureMode decides what happens to a write while the send buffer is above its high watermark.
+type BackpressureMode int
+
+const (
+	// BackpressureBlock waits until the buffer drained.
+	BackpressureBlock BackpressureMode = iota
+	// BackpressureDrop silently discards the message.
+	BackpressureDrop
+	// BackpressureError fails the write with ErrBufferFull.
+	BackpressureError
+)
+
 type WebRTCPeer struct {
-	channel *webrtc.DataChannel
+	channel    *webrtc.DataChannel
+	connection *webrtc.PeerConnection
 
 	messageChan chan []byte
 	assembler   *WebRTCMessageAssembler
+
+	highWatermark uint64
+	backpressure  BackpressureMode
+	bufferLow     chan struct{}
+	writeLock     sync.Mutex
+	scheduler     *writeScheduler
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+	flushed   chan struct{}
+	flushOnce sync.Once
 }
 
-func NewWebRTCPeer(channel *webrtc.DataChannel) *WebRTCPeer {
-	messageChan := make(chan []byte, 1)
+// NewWebRTCPeer wraps the data channel of the session, the peer is terminated once the data
+// channel or the peer connection is closed or fails. config may be nil to use the defaults.
+func NewWebRTCPeer(webRTCSession *WebRTCSession, config *PeerConfig) *WebRTCPeer {
+	if config == nil {
+		config = &PeerConfig{}
+	}
+
+	highWatermark := config.HighWatermark
+	if highWatermark == 0 {
+		highWatermark = DefaultHighWatermark
+	}
+
+	lowWatermark := config.LowWatermark
+	if lowWatermark == 0 || lowWatermark >= highWatermark {
+		lowWatermark = min(DefaultLowWatermark, highWatermark/4)
+	}
 
 	assembler := NewWebRTCMessageAssembler()
-	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
-		toSend := assembler.Feed(msg.Data)
+	assembler.SetFraming(webRTCSession.Framing)
+	chunkSize := config.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = webRTCSession.ChunkSize()
+	}
+	assembler.SetChunkSize(min(chunkSize, maxChunkSize))
+	if config.MaxMessageSize > 0 {
+		assembler.SetMaxMessageSize(config.MaxMessageSize)
+	}
+	assembler.SetCompression(webRTCSession.Compression, config.CompressionThreshold)
+
+	peer := &WebRTCPeer{
+		channel:       webRTCSession.Channel,
+		connection:    webRTCSession.Connection,
+		messageChan:   make(chan []byte, 1),
+		assembler:     assembler,
+		highWatermark: highWatermark,
+		backpressure:  config.Backpressure,
+		bufferLow:     make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		flushed:       make(chan struct{}),
+	}
+
+	if webRTCSession.Framing >= FramingVersion2 {
+		peer.scheduler = newWriteScheduler()
+		go peer.runScheduler()
+	}
+
+	peer.channel.SetBufferedAmountLowThreshold(lowWatermark)
+	peer.channel.OnBufferedAmountLow(func() {
+		select {
+		case peer.bufferLow <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-peer.done:
+			// Close waits for the buffer to run empty.
+			if peer.channel.BufferedAmount() == 0 {
+				peer.flushOnce.Do(func() { close(peer.flushed) })
+			}
+		default:
+		}
+	})
+
+	peer.channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		toSend, err := peer.assembler.Feed(msg.Data)
+		if err != nil {
+			// The stream can't be trusted anymore, drop the session.
+			peer.terminate(fmt.Errorf("%w: %w", ErrProtocolViolation, err))
+			go func() { _ = peer.Close() }()
+			return
+		}
 
-		if toSend != nil {
-			messageChan <- toSend
+		if toSend == nil {
+			return
 		}
+
+		select {
+		case peer.messageChan <- toSend:
+		case <-peer.done:
+		}
+	})
+	peer.channel.OnClose(func() {
+		peer.terminate(io.EOF)
+	})
+	peer.channel.OnError(func(err error) {
+		peer.terminate(fmt.Errorf("data channel error: %w", err))
 	})
 
-	return &WebRTCPeer{
-		channel:     channel,
-		messageChan: messageChan,
-		assembler:   assembler,
+	// Sessions created by hand only terminate the peer through the data channel.
+	if webRTCSession.states != nil {
+		webRTCSession.states.add(peer.connectionStateChanged)
+		peer.connectionStateChanged(peer.connection.ConnectionState())
+	}
+
+	return peer
+}
+
+func (w *WebRTCPeer) connectionStateChanged(state webrtc.PeerConnectionState) {
+	switch state {
+	case webrtc.PeerConnectionStateFailed:
+		w.terminate(ErrConnectionFailed)
+	case webrtc.PeerConnectionStateClosed:
+		w.terminate(io.EOF)
+	default:
 	}
 }
 
-func (w WebRTCPeer) Type() xconn.TransportType {
-	return xconn.TransportNone
+// terminate records why the peer stopped, only the first reason is kept.
+func (w *WebRTCPeer) terminate(err error) {
+	w.closeOnce.Do(func() {
+		w.err = err
+		close(w.done)
+	})
 }
 
-func (w WebRTCPeer) NetConn() net.Conn {
-	return nil
+func (w *WebRTCPeer) Type() xconn.TransportType {
+	return TransportWebRTC
+}
+
+// Details returns the details of the connection the peer runs over.
+func (w *WebRTCPeer) Details() (*ConnectionDetails, error) {
+	if w.connection == nil {
+		return nil, fmt.Errorf("peer has no connection")
+	}
+
+	webRTCSession := &WebRTCSession{Connection: w.connection, Channel: w.channel}
+	return webRTCSession.Details()
+}
+
+// CompressionStats returns the counters of the messages sent compressed.
+func (w *WebRTCPeer) CompressionStats() CompressionStats {
+	return w.assembler.CompressionStats()
+}
+
+func (w *WebRTCPeer) NetConn() net.Conn {
+	return &peerConn{peer: w}
+}
+
+func (w *WebRTCPeer) Read() ([]byte, error) {
+	select {
+	case msg := <-w.messageChan:
+		return msg, nil
+	case <-w.done:
+	}
+
+	// Hand out a message that was delivered right before the peer terminated.
+	select {
+	case msg := <-w.messageChan:
+		return msg, nil
+	default:
+		return nil, w.err
+	}
 }
 
-func (w WebRTCPeer) Read() ([]byte, error) {
-	return <-w.messageChan, nil
+func (w *WebRTCPeer) Write(bytes []byte) error {
+	return w.WriteContext(context.Background(), bytes)
 }
 
-func (w WebRTCPeer) Write(bytes []byte) error {
-	for chunk := range w.assembler.ChunkMessage(bytes) {
-		if err := w.channel.Send(chunk); err != nil {
+// WriteContext writes a message, waiting for the send buffer to drain gives up once ctx is
+// done. Chunks of concurrent writes are only interleaved if the framing supports it.
+func (w *WebRTCPeer) WriteContext(ctx context.Context, bytes []byte) error {
+	if w.channel.BufferedAmount() > w.highWatermark {
+		switch w.backpressure {
+		case BackpressureDrop:
+			return nil
+		case BackpressureError:
+			return ErrBufferFull
+		default:
+		}
+	}
+
+	if w.scheduler != nil {
+		return w.scheduleWrite(ctx, bytes)
+	}
+
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	started := false
+	return w.assembler.WriteChunks(bytes, func(chunk []byte) error {
+		if err := w.waitWritable(ctx); err != nil {
+			if started && ctx.Err() != nil {
+				// The remote already got part of the message and can't make sense of anything
+				// that follows, so the peer is unusable.
+				_ = w.Close()
+			}
+
 			return err
 		}
+
+		started = true
+		return w.channel.Send(chunk)
+	})
+}
+
+// waitWritable blocks while the send buffer is above the high watermark.
+func (w *WebRTCPeer) waitWritable(ctx context.Context) error {
+	for {
+		select {
+		case <-w.done:
+			return w.err
+		default:
+		}
+
+		if w.channel.BufferedAmount() <= w.highWatermark {
+			return nil
+		}
+
+		select {
+		case <-w.bufferLow:
+		case <-w.done:
+			return w.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close tears down both the data channel and the peer connection. Messages that were
+// already written get a chance to reach the remote peer first, e.g. a GOODBYE.
+func (w *WebRTCPeer) Close() error {
+	w.terminate(io.EOF)
+
+	// Get notified once the buffer ran empty rather than below the low watermark.
+	w.channel.SetBufferedAmountLowThreshold(0)
+	if w.channel.ReadyState() == webrtc.DataChannelStateOpen && w.channel.BufferedAmount() > 0 {
+		select {
+		case <-w.flushed:
+		case <-time.After(closeFlushTimeout):
+		}
+	}
+
+	err := w.channel.Close()
+	if w.connection != nil {
+		err = errors.Join(err, w.connection.Close())
+	}
+
+	return err
+}
+
+// peerConn exposes the peer to xconn, which closes sessions through their net.Conn.
+// The data channel is message oriented, so reading and writing bytes is not supported.
+type peerConn struct {
+	peer *WebRTCPeer
+}
+
+func (c *peerConn) Read([]byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (c *peerConn) Write([]byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (c *peerConn) Close() error {
+	return c.peer.Close()
+}
+
+func (c *peerConn) LocalAddr() net.Addr {
+	if details, err := c.peer.Details(); err == nil {
+		return details.LocalAddr()
 	}
 
-	return nil
+	return peerAddr(c.peer.channel.Label())
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	if details, err := c.peer.Details(); err == nil {
+		return details.RemoteAddr()
+	}
+
+	return peerAddr(c.peer.channel.Label())
+}
+
+func (c *peerConn) SetDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+func (c *peerConn) SetReadDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+func (c *peerConn) SetWriteDeadline(time.Time) error {
+	return errors.ErrUnsupported
+}
+
+type peerAddr string
+
+func (a peerAddr) Network() string {
+	return "webrtc"
+}
+
+func (a peerAddr) String() string {
+	return string(a)
 }
@@ -0,0 +1,216 @@
+package wamp_webrtc_go_test
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/xconn-go"
+)
+
+// connectSessions returns the provider and the client side of a freshly established WebRTC connection.
+func connectSessions(t testing.TB) (*wamp_webrtc_go.WebRTCSession, *wamp_webrtc_go.WebRTCSession) {
+	_, offererSignaler, sessions := setupMemoryProvider(t, &wamp_webrtc_go.ProviderConfig{})
+
+	client, err := wamp_webrtc_go.ConnectWebRTC(&wamp_webrtc_go.ClientConfig{
+		Realm:      wamp_webrtc_go.DefaultRealm,
+		Serializer: xconn.CBORSerializerSpec,
+		Signaler:   offererSignaler,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Connection.Close() })
+
+	return <-sessions, client
+}
+
+func TestWebRTCPeerBackpressure(t *testing.T) {
+	webRTCSession, remoteSession := connectSessions(t)
+	message := make([]byte, 64*1024)
+
+	remote := wamp_webrtc_go.NewWebRTCPeer(remoteSession, nil)
+	go func() {
+		for {
+			if _, err := remote.Read(); err != nil {
+				return
+			}
+		}
+	}()
+
+	t.Run("Error", func(t *testing.T) {
+		peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, &wamp_webrtc_go.PeerConfig{
+			HighWatermark: 1,
+			Backpressure:  wamp_webrtc_go.BackpressureError,
+		})
+
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			err = peer.Write(message)
+		}
+		require.ErrorIs(t, err, wamp_webrtc_go.ErrBufferFull)
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, &wamp_webrtc_go.PeerConfig{HighWatermark: 128 * 1024})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		for i := 0; i < 100; i++ {
+			require.NoError(t, peer.WriteContext(ctx, message))
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, nil)
+		require.NoError(t, peer.Close())
+
+		_, err := peer.Read()
+		require.Error(t, err)
+		require.Error(t, peer.Write(message))
+	})
+}
+
+func TestWebRTCPeerProtocolViolation(t *testing.T) {
+	webRTCSession, remoteSession := connectSessions(t)
+	peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, nil)
+
+	// Every frame carries at least its header byte.
+	require.NoError(t, remoteSession.Channel.Send([]byte{}))
+
+	_, err := peer.Read()
+	require.ErrorIs(t, err, wamp_webrtc_go.ErrProtocolViolation)
+	require.ErrorIs(t, err, wamp_webrtc_go.ErrMalformedFrame)
+}
+
+func TestFramingNegotiation(t *testing.T) {
+	webRTCSession, remoteSession := connectSessions(t)
+	require.Equal(t, wamp_webrtc_go.SupportedFraming, webRTCSession.Framing)
+	require.Equal(t, wamp_webrtc_go.SupportedFraming, remoteSession.Framing)
+	require.Equal(t, wamp_webrtc_go.CompressionDeflate, webRTCSession.Compression)
+	require.Equal(t, wamp_webrtc_go.CompressionDeflate, remoteSession.Compression)
+	// Pion doesn't advertise a=max-message-size and receives messages of up to 64 KiB - 1.
+	require.Equal(t, 64*1024-1, webRTCSession.ChunkSize())
+
+	// Offers of peers predating versioned framing don't carry it.
+	offerer := wamp_webrtc_go.NewOfferer()
+	t.Cleanup(func() { _ = offerer.Close() })
+	signaler, _ := newMemorySignalerPair()
+	offer, err := offerer.Offer(&wamp_webrtc_go.OfferConfig{}, signaler, "request")
+	require.NoError(t, err)
+	offer.Framing = 0
+	offer.Compression = nil
+
+	answerer := wamp_webrtc_go.NewAnswerer()
+	t.Cleanup(func() { _ = answerer.Close() })
+	answer, err := answerer.Answer(&wamp_webrtc_go.AnswerConfig{}, *offer, 0)
+	require.NoError(t, err)
+	require.Equal(t, wamp_webrtc_go.FramingLegacy, answer.Framing)
+	require.Empty(t, answer.Compression)
+}
+
+func TestWebRTCPeerInterleaving(t *testing.T) {
+	webRTCSession, remoteSession := connectSessions(t)
+	peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, nil)
+	remote := wamp_webrtc_go.NewWebRTCPeer(remoteSession, nil)
+
+	large := make([]byte, 8<<20)
+	errs := make(chan error, 1)
+	go func() { errs <- peer.Write(large) }()
+
+	// The small message must not wait for the large one to be sent completely, so it is only
+	// written once the remote received the first chunks of the large one.
+	require.Eventually(t, func() bool {
+		stats, ok := remoteSession.Connection.GetStats().GetDataChannelStats(remoteSession.Channel)
+		return ok && stats.MessagesReceived > 0
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, peer.Write([]byte("hello")))
+
+	message, err := remote.Read()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), message)
+
+	message, err = remote.Read()
+	require.NoError(t, err)
+	require.Len(t, message, len(large))
+	require.NoError(t, <-errs)
+}
+
+func TestWebRTCPeerConnectionState(t *testing.T) {
+	webRTCSession, _ := connectSessions(t)
+
+	// Watching the state next to the peer must not take over each other's callbacks.
+	states := make(chan webrtc.PeerConnectionState, 8)
+	webRTCSession.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		select {
+		case states <- state:
+		default:
+		}
+	})
+	peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, nil)
+
+	require.NoError(t, webRTCSession.Connection.Close())
+	// Depending on what notices first, the data channel may report an error instead of EOF.
+	_, err := peer.Read()
+	require.Error(t, err)
+
+	for closed := false; !closed; {
+		select {
+		case state := <-states:
+			closed = state == webrtc.PeerConnectionStateClosed
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "closed state was not reported")
+		}
+	}
+}
+
+func TestWebRTCPeerCompression(t *testing.T) {
+	webRTCSession, remoteSession := connectSessions(t)
+	peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, &wamp_webrtc_go.PeerConfig{CompressionThreshold: 1024})
+	remote := wamp_webrtc_go.NewWebRTCPeer(remoteSession, nil)
+
+	large := bytes.Repeat([]byte("compressible "), 100_000)
+	require.NoError(t, peer.Write(large))
+
+	message, err := remote.Read()
+	require.NoError(t, err)
+	require.Equal(t, large, message)
+	require.Equal(t, uint64(1), peer.CompressionStats().Messages)
+	require.Zero(t, remote.CompressionStats().Messages)
+}
+
+func BenchmarkWebRTCPeerWrite(b *testing.B) {
+	webRTCSession, remoteSession := connectSessions(b)
+	peer := wamp_webrtc_go.NewWebRTCPeer(webRTCSession, nil)
+	remote := wamp_webrtc_go.NewWebRTCPeer(remoteSession, nil)
+
+	for _, size := range []int{64, 4 * 1024, 256 * 1024} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			message := make([]byte, size)
+			received := make(chan error, 1)
+			go func() {
+				for i := 0; i < b.N; i++ {
+					if _, err := remote.Read(); err != nil {
+						received <- err
+						return
+					}
+				}
+				received <- nil
+			}()
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := peer.Write(message); err != nil {
+					b.Fatal(err)
+				}
+			}
+			require.NoError(b, <-received)
+		})
+	}
+}
@@ -2,8 +2,9 @@ package wamp_webrtc_go
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -11,25 +12,69 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/messages"
 	"github.com/xconnio/xconn-go"
 )
 
+const (
+	answererTimeout      = 20 * time.Second
+	answererReapInterval = 30 * time.Second
+)
+
 type WebRTCProvider struct {
 	answerers     map[string]*Answerer
 	onNewAnswerer func(sessionID string, answerer *Answerer)
 
-	iceServers []webrtc.ICEServer
+	iceServers    []webrtc.ICEServer
+	settingEngine *webrtc.SettingEngine
+	router        *xconn.Router
+	signaler      AnswererSignaler
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	turnSecret             string
+	turnCredentialTTL      time.Duration
+	turnAuthID             string
+	iceServersRegistration *xconn.RegisterResponse
 
 	sync.Mutex
 }
 
 func NewWebRTCHandler() *WebRTCProvider {
 	return &WebRTCProvider{
-		answerers:  make(map[string]*Answerer),
-		iceServers: make([]webrtc.ICEServer, 0),
+		answerers: make(map[string]*Answerer),
+		done:      make(chan struct{}),
 	}
 }
 
+// DefaultICEServers returns the public STUN servers used if ProviderConfig sets
+// UseDefaultICEServers.
+func DefaultICEServers() []webrtc.ICEServer {
+	return []webrtc.ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}}
+}
+
+// SetICEServers replaces the ICE servers answering later offers, connections that are
+// already established keep theirs.
+func (r *WebRTCProvider) SetICEServers(servers []webrtc.ICEServer) {
+	r.Lock()
+	defer r.Unlock()
+
+	// The slice is never modified once stored, offers use it without copying.
+	r.iceServers = slices.Clone(servers)
+}
+
+// ICEServers returns the ICE servers offers are currently answered with.
+func (r *WebRTCProvider) ICEServers() []webrtc.ICEServer {
+	return slices.Clone(r.currentICEServers())
+}
+
+func (r *WebRTCProvider) currentICEServers() []webrtc.ICEServer {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.iceServers
+}
+
 func (r *WebRTCProvider) OnAnswerer(callback func(sessionID string, answerer *Answerer)) {
 	r.Lock()
 	defer r.Unlock()
@@ -44,6 +89,9 @@ func (r *WebRTCProvider) ensureAnswerer(sessionID string) *Answerer {
 	answerer, exists := r.answerers[sessionID]
 	if !exists {
 		answerer = NewAnswerer()
+		answerer.OnClose(func() {
+			r.removeAnswerer(sessionID, answerer)
+		})
 		r.answerers[sessionID] = answerer
 		if r.onNewAnswerer != nil {
 			r.onNewAnswerer(sessionID, answerer)
@@ -53,6 +101,50 @@ func (r *WebRTCProvider) ensureAnswerer(sessionID string) *Answerer {
 	return answerer
 }
 
+func (r *WebRTCProvider) removeAnswerer(sessionID string, answerer *Answerer) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.answerers[sessionID] == answerer {
+		r.forget(sessionID)
+	}
+}
+
+// forget drops all state of a request, must be called with the lock held.
+func (r *WebRTCProvider) forget(requestID string) {
+	delete(r.answerers, requestID)
+	if r.signaler != nil {
+		r.signaler.Release(requestID)
+	}
+}
+
+// reapOrphans periodically drops answerers that never received an offer until done is closed.
+func (r *WebRTCProvider) reapOrphans(done <-chan struct{}) {
+	ticker := time.NewTicker(answererReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.dropOrphans(answererTimeout)
+		case <-done:
+			return
+		}
+	}
+}
+
+// dropOrphans drops answerers that never received an offer within maxAge.
+func (r *WebRTCProvider) dropOrphans(maxAge time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	for sessionID, answerer := range r.answerers {
+		if answerer.orphaned(maxAge) {
+			r.forget(sessionID)
+		}
+	}
+}
+
 func (r *WebRTCProvider) addIceCandidate(requestID string, candidate webrtc.ICECandidateInit) error {
 	answerer := r.ensureAnswerer(requestID)
 	return answerer.AddICECandidate(candidate)
@@ -60,183 +152,228 @@ func (r *WebRTCProvider) addIceCandidate(requestID string, candidate webrtc.ICEC
 
 func (r *WebRTCProvider) handleOffer(requestID string, offer Offer, answerConfig *AnswerConfig) (*Answer, error) {
 	answerer := r.ensureAnswerer(requestID)
-	return answerer.Answer(answerConfig, offer, 100*time.Millisecond)
+	answer, err := answerer.Answer(answerConfig, offer, 100*time.Millisecond)
+	if err != nil {
+		_ = answerer.Close()
+		return nil, err
+	}
+
+	return answer, nil
 }
 
 func (r *WebRTCProvider) Setup(config *ProviderConfig) {
-	r.iceServers = append(r.iceServers, config.IceServers...)
-	registerResp := config.Session.Register(config.ProcedureHandleOffer, r.offerFunc).Do()
-	if registerResp.Err != nil {
-		log.Errorf("failed to register webrtc offer: %v", registerResp.Err)
+	if !config.Routed && config.BridgeURL == "" && config.OnSession == nil {
+		log.Errorf("invalid provider config: OnSession must be set unless Routed or BridgeURL is")
 		return
 	}
 
-	subscribeResp := config.Session.Subscribe(config.TopicHandleRemoteCandidates, r.onRemoteCandidate).Do()
-	if subscribeResp.Err != nil {
-		log.Errorf("failed to subscribe to webrtc candidates events: %v", subscribeResp.Err)
-		return
+	// Servers set through SetICEServers beforehand are kept unless the config brings its own.
+	if len(config.IceServers) > 0 || config.UseDefaultICEServers {
+		iceServers := config.IceServers
+		if config.UseDefaultICEServers {
+			iceServers = append(slices.Clone(iceServers), DefaultICEServers()...)
+		}
+		r.SetICEServers(iceServers)
+	}
+	r.setupTURNCredentials(config)
+
+	if config.Routed {
+		router, err := sharedRouter(config)
+		if err != nil {
+			log.Errorf("failed to setup router: %v", err)
+			return
+		}
+
+		r.router = router
 	}
 
+	signaler := config.Signaler
+	if signaler == nil {
+		signaler = NewWAMPAnswererSignaler(config.Session, config.ProcedureHandleOffer,
+			config.TopicHandleRemoteCandidates, config.TopicPublishLocalCandidate)
+	}
+
+	r.Lock()
+	r.signaler = signaler
+	r.settingEngine = config.SettingEngine
+	r.Unlock()
+
+	go r.reapOrphans(r.done)
+
 	r.OnAnswerer(func(sessionID string, answerer *Answerer) {
 		answerer.OnIceCandidate(func(candidate *webrtc.ICECandidate) {
-			answerData, err := json.Marshal(candidate.ToJSON())
-			if err != nil {
-				log.Errorf("failed to marshal answer: %v", err)
-				return
-			}
-
-			args := []any{sessionID, string(answerData)}
-			publishResp := config.Session.Publish(config.TopicPublishLocalCandidate).Args(args...).Do()
-			if publishResp.Err != nil {
-				log.Errorf("failed to publish answer: %v", publishResp.Err)
+			if err := signaler.SendCandidate(sessionID, candidateInit(candidate)); err != nil {
+				log.Errorf("failed to send candidate: %v", err)
 			}
 		})
 
 		go func() {
 			select {
 			case channel := <-answerer.WaitReady():
-				if err := r.handleWAMPClient(channel, config); err != nil {
+				webRTCSession := answerer.session(channel)
+				if err := r.handleWAMPClient(webRTCSession, config); err != nil {
 					log.Errorf("failed to handle answer: %v", err)
-					_ = answerer.connection.Close()
+					_ = answerer.Close()
 				}
-			case <-time.After(20 * time.Second):
-				log.Errorln("webrtc connection didn't establish after 20 seconds")
+			case <-time.After(answererTimeout):
+				log.Errorf("webrtc connection didn't establish after %s", answererTimeout)
+				_ = answerer.Close()
 			}
 		}()
 	})
-}
-
-func (r *WebRTCProvider) handleWAMPClient(channel *webrtc.DataChannel, config *ProviderConfig) error {
-	rtcPeer := NewWebRTCPeer(channel)
 
-	hello, err := xconn.ReadHello(rtcPeer, config.Serializer)
-	if err != nil {
-		return err
+	if err := signaler.OnCandidate(r.onRemoteCandidate); err != nil {
+		log.Errorf("failed to receive webrtc candidates: %v", err)
+		return
 	}
 
-	base, err := xconn.Accept(rtcPeer, hello, config.Serializer, config.Authenticator)
-	if err != nil {
-		return err
+	if err := signaler.OnOffer(r.onOffer); err != nil {
+		log.Errorf("failed to receive webrtc offers: %v", err)
+		return
 	}
 
-	if !config.Routed {
-		return nil
+	if config.ProcedureICEServers != "" {
+		if err := r.registerICEServers(config); err != nil {
+			log.Errorf("failed to register ice servers procedure: %v", err)
+		}
 	}
+}
 
-	xconnRouter := xconn.NewRouter()
-	if err := xconnRouter.AddRealm("realm1"); err != nil {
-		return err
-	}
-	if err = xconnRouter.AttachClient(base); err != nil {
-		return fmt.Errorf("failed to attach client %w", err)
+func (r *WebRTCProvider) registerICEServers(config *ProviderConfig) error {
+	if config.Session == nil {
+		return fmt.Errorf("no session to register %s on", config.ProcedureICEServers)
 	}
 
-	parser := NewWebRTCMessageAssembler()
-	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
-		fullMsg := parser.Feed(msg.Data)
+	registerResponse := config.Session.Register(config.ProcedureICEServers,
+		func(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+			return r.handleICEServers(invocation)
+		}).Do()
+	if registerResponse.Err != nil {
+		return registerResponse.Err
+	}
 
-		if fullMsg != nil {
-			if err = base.Write(fullMsg); err != nil {
-				log.Errorf("failed to send wamp message: %v", err)
-				return
-			}
-		}
-	})
+	r.Lock()
+	r.iceServersRegistration = &registerResponse
+	r.Unlock()
 
-	channel.OnClose(func() {
-		_ = base.Close()
-	})
+	return nil
+}
 
-	for {
-		msg, err := base.ReadMessage()
-		if err != nil {
-			_ = xconnRouter.DetachClient(base)
-			break
-		}
+// Close stops accepting new connections, established ones are left untouched.
+func (r *WebRTCProvider) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
 
-		if err = xconnRouter.ReceiveMessage(base, msg); err != nil {
-			log.Println(err)
-			return nil
-		}
+	r.Lock()
+	signaler, registration := r.signaler, r.iceServersRegistration
+	r.iceServersRegistration = nil
+	r.Unlock()
 
-		data, err := config.Serializer.Serialize(msg)
-		if err != nil {
-			log.Printf("failed to serialize message: %v", err)
-			return nil
-		}
+	var err error
+	if registration != nil {
+		err = registration.Unregister()
+	}
 
-		for chunk := range parser.ChunkMessage(data) {
-			if err = channel.Send(chunk); err != nil {
-				log.Errorf("failed to write message: %v", err)
-				return nil
-			}
-		}
+	if signaler == nil {
+		return err
 	}
 
-	return err
+	return errors.Join(err, signaler.Close())
 }
 
-func (r *WebRTCProvider) offerFunc(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
-	if len(invocation.Args()) < 2 {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument)
+// sharedRouter returns the router all routed WebRTC clients are attached to. If the
+// config doesn't carry one, a local router serving DefaultRealm is created.
+func sharedRouter(config *ProviderConfig) (*xconn.Router, error) {
+	if config.Router != nil {
+		return config.Router, nil
 	}
 
-	requestID, err := invocation.ArgString(0)
-	if err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, "request ID must be a string")
+	router := xconn.NewRouter()
+	if err := router.AddRealm(DefaultRealm); err != nil {
+		return nil, err
 	}
 
-	offerJSON, err := invocation.ArgString(1)
-	if err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, "offer JSON must be a string")
+	return router, nil
+}
+
+func (r *WebRTCProvider) handleWAMPClient(webRTCSession *WebRTCSession, config *ProviderConfig) error {
+	channel := webRTCSession.Channel
+	rtcPeer := NewWebRTCPeer(webRTCSession, config.PeerConfig)
+
+	if config.BridgeURL != "" {
+		return bridgeClient(rtcPeer, channel.Protocol(), config.BridgeURL)
 	}
 
-	var offer Offer
-	if err := json.Unmarshal([]byte(offerJSON), &offer); err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+	hello, err := xconn.ReadHello(rtcPeer, config.Serializer)
+	if err != nil {
+		return err
 	}
 
-	r.iceServers = append(r.iceServers, webrtc.ICEServer{URLs: []string{"stun:stun.l.google.com:19302"}})
+	if config.Routed && !r.router.HasRealm(hello.Realm()) {
+		abort := messages.NewAbort(map[string]any{}, wampproto.ErrNoSuchRealm, nil, nil)
+		if err = xconn.WriteMessage(rtcPeer, abort, config.Serializer); err != nil {
+			return fmt.Errorf("failed to send abort: %w", err)
+		}
 
-	cfg := &AnswerConfig{ICEServers: r.iceServers}
+		return fmt.Errorf("%s: %s", wampproto.ErrNoSuchRealm, hello.Realm())
+	}
 
-	answer, err := r.handleOffer(requestID, offer, cfg)
+	base, err := xconn.Accept(rtcPeer, hello, config.Serializer, config.Authenticator)
 	if err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+		return err
 	}
 
-	answerData, err := json.Marshal(answer)
-	if err != nil {
-		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+	if details, err := rtcPeer.Details(); err == nil {
+		log.Debugf("accepted session %d (authid=%s) over %s", base.ID(), base.AuthID(), details)
 	}
 
-	return xconn.NewInvocationResult(string(answerData))
+	if !config.Routed {
+		config.OnSession(base, webRTCSession)
+		return nil
+	}
+
+	return r.routeClient(base)
 }
 
-func (r *WebRTCProvider) onRemoteCandidate(event *xconn.Event) {
-	if len(event.Args()) < 2 {
-		return
+func (r *WebRTCProvider) routeClient(base xconn.BaseSession) error {
+	if err := r.router.AttachClient(base); err != nil {
+		return fmt.Errorf("failed to attach client %w", err)
 	}
 
-	requestID, err := event.ArgString(0)
-	if err != nil {
-		log.Errorln("request ID must be a string")
-		return
-	}
+	defer func() {
+		// The router already drops clients that said goodbye.
+		if err := r.router.DetachClient(base); err != nil {
+			log.Debugf("failed to detach client: %v", err)
+		}
+	}()
 
-	candidateJSON, err := event.ArgString(1)
-	if err != nil {
-		log.Errorln("offer must be a string")
-		return
+	for {
+		msg, err := base.ReadMessage()
+		if err != nil {
+			return nil
+		}
+
+		if err = r.router.ReceiveMessage(base, msg); err != nil {
+			return err
+		}
 	}
+}
+
+func (r *WebRTCProvider) onOffer(requestID string, offer *Offer) (*Answer, error) {
+	r.Lock()
+	authID, settingEngine := r.turnAuthID, r.settingEngine
+	r.Unlock()
 
-	var candidate webrtc.ICECandidateInit
-	if err := json.Unmarshal([]byte(candidateJSON), &candidate); err != nil {
+	cfg := &AnswerConfig{ICEServers: r.iceServersFor(authID), SettingEngine: settingEngine}
+
+	return r.handleOffer(requestID, *offer, cfg)
+}
+
+func (r *WebRTCProvider) onRemoteCandidate(requestID string, candidate *webrtc.ICECandidateInit) {
+	if candidate == nil {
 		return
 	}
 
-	if err := r.addIceCandidate(requestID, candidate); err != nil {
+	if err := r.addIceCandidate(requestID, *candidate); err != nil {
 		log.Errorf("failed to add ice candidate: %v", err)
-		return
 	}
 }
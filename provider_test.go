@@ -0,0 +1,381 @@
+package wamp_webrtc_go_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/wampproto-go/serializers"
+	"github.com/xconnio/xconn-go"
+)
+
+const (
+	procedureWebRTCOffer     = "io.xconn.webrtc.offer"
+	topicAnswererOnCandidate = "io.xconn.webrtc.answerer.on_candidate"
+	topicOffererOnCandidate  = "io.xconn.webrtc.offerer.on_candidate"
+)
+
+func echo(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+	return xconn.NewInvocationResult(invocation.Args()...)
+}
+
+func serveWebSocket(t *testing.T, router *xconn.Router) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	closer := xconn.NewServer(router, nil, nil).Serve(listener, xconn.ListenerWebSocket)
+	t.Cleanup(func() { _ = closer.Close() })
+
+	return fmt.Sprintf("ws://%s/ws", listener.Addr())
+}
+
+func setupProvider(t *testing.T, config *wamp_webrtc_go.ProviderConfig) *xconn.Router {
+	signalingRouter := xconn.NewRouter()
+	require.NoError(t, signalingRouter.AddRealm("realm1"))
+	require.NoError(t, signalingRouter.AutoDiscloseCaller("realm1", true))
+	require.NoError(t, signalingRouter.AutoDisclosePublisher("realm1", true))
+	t.Cleanup(signalingRouter.Close)
+
+	// The provider yields and publishes from several goroutines at once, which in-memory
+	// sessions don't support.
+	session, err := xconn.ConnectAnonymous(context.Background(), serveWebSocket(t, signalingRouter), "realm1")
+	require.NoError(t, err)
+
+	config.Session = session
+	config.ProcedureHandleOffer = procedureWebRTCOffer
+	config.TopicHandleRemoteCandidates = topicAnswererOnCandidate
+	config.TopicPublishLocalCandidate = topicOffererOnCandidate
+	config.Serializer = &serializers.CBORSerializer{}
+
+	provider := wamp_webrtc_go.NewWebRTCHandler()
+	provider.Setup(config)
+	t.Cleanup(func() { _ = provider.Close() })
+
+	return signalingRouter
+}
+
+// setupMemoryProvider sets up a provider signaling through memory. Unless the config is
+// routed or sets OnSession, accepted sessions are delivered to the returned channel.
+func setupMemoryProvider(t testing.TB, config *wamp_webrtc_go.ProviderConfig) (*wamp_webrtc_go.WebRTCProvider,
+	*memorySignaler, chan *wamp_webrtc_go.WebRTCSession) {
+	offererSignaler, answererSignaler := newMemorySignalerPair()
+	sessions := make(chan *wamp_webrtc_go.WebRTCSession, 1)
+
+	config.Signaler = answererSignaler
+	config.Serializer = &serializers.CBORSerializer{}
+	if !config.Routed && config.OnSession == nil {
+		config.OnSession = func(_ xconn.BaseSession, webRTCSession *wamp_webrtc_go.WebRTCSession) {
+			sessions <- webRTCSession
+		}
+	}
+
+	provider := wamp_webrtc_go.NewWebRTCHandler()
+	provider.Setup(config)
+	t.Cleanup(func() { _ = provider.Close() })
+
+	return provider, offererSignaler, sessions
+}
+
+// wampClientConfig returns the config of a client signaling through session.
+func wampClientConfig(session *xconn.Session) *wamp_webrtc_go.ClientConfig {
+	return &wamp_webrtc_go.ClientConfig{
+		Realm:                    "realm1",
+		ProcedureWebRTCOffer:     procedureWebRTCOffer,
+		TopicAnswererOnCandidate: topicAnswererOnCandidate,
+		TopicOffererOnCandidate:  topicOffererOnCandidate,
+		Serializer:               xconn.CBORSerializerSpec,
+		Session:                  session,
+	}
+}
+
+func connectClient(t *testing.T, signalingRouter *xconn.Router) *xconn.Session {
+	session, err := xconn.ConnectInMemory(signalingRouter, "realm1")
+	require.NoError(t, err)
+
+	client, err := wamp_webrtc_go.ConnectWAMP(wampClientConfig(session))
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestProviderSharedRouter(t *testing.T) {
+	router := xconn.NewRouter()
+	require.NoError(t, router.AddRealm("realm1"))
+	t.Cleanup(router.Close)
+
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{Routed: true, Router: router})
+
+	callee := connectClient(t, signalingRouter)
+	registerResp := callee.Register("io.xconn.echo", echo).Do()
+	require.NoError(t, registerResp.Err)
+
+	caller := connectClient(t, signalingRouter)
+	callResp := caller.Call("io.xconn.echo").Arg("hello").Do()
+	require.NoError(t, callResp.Err)
+	require.Equal(t, "hello", callResp.Args.StringOr(0, ""))
+
+	// Leaving must detach the callee from the shared router.
+	require.NoError(t, callee.Leave())
+	require.Eventually(t, func() bool {
+		return caller.Call("io.xconn.echo").Do().Err != nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestProviderOnSession(t *testing.T) {
+	sessions := make(chan xconn.BaseSession, 1)
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{
+		OnSession: func(base xconn.BaseSession, _ *wamp_webrtc_go.WebRTCSession) {
+			sessions <- base
+		},
+	})
+
+	client := connectClient(t, signalingRouter)
+
+	var base xconn.BaseSession
+	select {
+	case base = <-sessions:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "session was not handed to OnSession")
+	}
+	require.Equal(t, client.ID(), base.ID())
+	require.Equal(t, "realm1", base.Realm())
+
+	details, ok := wamp_webrtc_go.ConnectionDetailsOf(base)
+	require.True(t, ok)
+	require.Equal(t, xconn.CBORSerializerSpec.SubProtocol(), details.Protocol)
+	require.False(t, details.Relayed())
+	require.NotEmpty(t, details.RemoteFingerprint)
+	require.Equal(t, details.RemoteAddr(), base.NetConn().RemoteAddr())
+
+	// Closing the session on the provider side must end the client session as well.
+	require.NoError(t, base.Close())
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "client session was not closed")
+	}
+}
+
+func TestProviderInvalidConfig(t *testing.T) {
+	// Without a router, a bridge or OnSession accepted sessions would have nowhere to go.
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{})
+
+	session, err := xconn.ConnectInMemory(signalingRouter, "realm1")
+	require.NoError(t, err)
+
+	callResponse := session.Call(procedureWebRTCOffer).Do()
+	var callErr *xconn.Error
+	require.ErrorAs(t, callResponse.Err, &callErr)
+	require.Equal(t, wampproto.ErrNoSuchProcedure, callErr.URI)
+}
+
+func TestProviderBridge(t *testing.T) {
+	router := xconn.NewRouter()
+	require.NoError(t, router.AddRealm("realm1"))
+
+	upstreamURL := serveWebSocket(t, router)
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{
+		BridgeURL: upstreamURL,
+	})
+
+	client := connectClient(t, signalingRouter)
+	registerResp := client.Register("io.xconn.echo", echo).Do()
+	require.NoError(t, registerResp.Err)
+
+	upstream, err := xconn.ConnectAnonymous(context.Background(), upstreamURL, "realm1")
+	require.NoError(t, err)
+
+	callResp := upstream.Call("io.xconn.echo").Arg("hello").Do()
+	require.NoError(t, callResp.Err)
+	require.Equal(t, "hello", callResp.Args.StringOr(0, ""))
+
+	// Leaving tears down the bridged session upstream as well.
+	require.NoError(t, client.Leave())
+	require.Eventually(t, func() bool {
+		return upstream.Call("io.xconn.echo").Do().Err != nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestProviderICEServers(t *testing.T) {
+	provider, offererSignaler, sessions := setupMemoryProvider(t, &wamp_webrtc_go.ProviderConfig{})
+
+	// ICE servers are opt-in.
+	require.Empty(t, provider.ICEServers())
+
+	servers := []webrtc.ICEServer{{URLs: []string{"stun:127.0.0.1:3478"}}}
+	provider.SetICEServers(servers)
+	servers[0].URLs = nil
+	require.Equal(t, "stun:127.0.0.1:3478", provider.ICEServers()[0].URLs[0])
+
+	client, err := wamp_webrtc_go.ConnectWebRTC(&wamp_webrtc_go.ClientConfig{
+		Realm:      wamp_webrtc_go.DefaultRealm,
+		Serializer: xconn.CBORSerializerSpec,
+		Signaler:   offererSignaler,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Connection.Close() })
+
+	webRTCSession := <-sessions
+	require.Equal(t, provider.ICEServers(), webRTCSession.Connection.GetConfiguration().ICEServers)
+
+	// Servers set before Setup are kept if the config doesn't bring its own.
+	configured := wamp_webrtc_go.NewWebRTCHandler()
+	configured.SetICEServers(provider.ICEServers())
+	configured.Setup(&wamp_webrtc_go.ProviderConfig{Signaler: &memorySignaler{}, Routed: true})
+	t.Cleanup(func() { _ = configured.Close() })
+	require.Equal(t, provider.ICEServers(), configured.ICEServers())
+}
+
+func TestProviderICEServersProcedure(t *testing.T) {
+	const procedureICEServers = "io.xconn.webrtc.ice_servers"
+
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{
+		Routed: true,
+		IceServers: []webrtc.ICEServer{
+			{URLs: []string{"stun:127.0.0.1:3478"}},
+			{URLs: []string{"turn:127.0.0.1:3478"}},
+		},
+		ProcedureICEServers: procedureICEServers,
+		TURNSecret:          "secret",
+		TURNCredentialTTL:   time.Hour,
+	})
+
+	session, err := xconn.ConnectInMemory(signalingRouter, "realm1")
+	require.NoError(t, err)
+
+	callResponse := session.Call(procedureICEServers).Option("disclose_me", true).Do()
+	require.NoError(t, callResponse.Err)
+	serversJSON, err := callResponse.Args.String(0)
+	require.NoError(t, err)
+
+	var servers []webrtc.ICEServer
+	require.NoError(t, json.Unmarshal([]byte(serversJSON), &servers))
+	require.Len(t, servers, 2)
+	require.Empty(t, servers[0].Username)
+
+	// The TURN credentials are bound to the caller and expire after the configured TTL.
+	turn := servers[1]
+	_, authID, _ := strings.Cut(turn.Username, ":")
+	require.Equal(t, session.Details().AuthID(), authID)
+	require.Equal(t, wamp_webrtc_go.TURNCredential("secret", turn.Username), turn.Credential)
+	expiry, err := wamp_webrtc_go.TURNCredentialExpiry(turn.Username)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+
+	config := wampClientConfig(session)
+	config.ProcedureICEServers = procedureICEServers
+	client, err := wamp_webrtc_go.ConnectWAMP(config)
+	require.NoError(t, err)
+	require.NoError(t, client.Leave())
+}
+
+func TestTURNCredentials(t *testing.T) {
+	require.Equal(t, "d8soP47RbdIKLDUOpnJPVQyq5Ts=", wamp_webrtc_go.TURNCredential("secret", "1700000000:alice"))
+
+	username, credential := wamp_webrtc_go.TURNCredentials("secret", "alice", time.Minute)
+	require.True(t, strings.HasSuffix(username, ":alice"))
+	require.Equal(t, wamp_webrtc_go.TURNCredential("secret", username), credential)
+
+	_, err := wamp_webrtc_go.TURNCredentialExpiry("alice")
+	require.Error(t, err)
+}
+
+func TestProviderRelayOnly(t *testing.T) {
+	const procedureICEServers = "io.xconn.webrtc.ice_servers"
+
+	turnServer, err := wamp_webrtc_go.NewTURNServer(&wamp_webrtc_go.TURNServerConfig{
+		ListenAddress: "127.0.0.1:0",
+		Secret:        "secret",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = turnServer.Close() })
+
+	sessions := make(chan xconn.BaseSession, 1)
+	signalingRouter := setupProvider(t, &wamp_webrtc_go.ProviderConfig{
+		IceServers:          []webrtc.ICEServer{{URLs: []string{turnServer.URL()}}},
+		ProcedureICEServers: procedureICEServers,
+		TURNSecret:          "secret",
+		OnSession: func(base xconn.BaseSession, _ *wamp_webrtc_go.WebRTCSession) {
+			sessions <- base
+		},
+	})
+
+	session, err := xconn.ConnectInMemory(signalingRouter, "realm1")
+	require.NoError(t, err)
+
+	// Relay candidates may still be trickled once the connection is up, so the signaler is kept
+	// rather than closed after connecting. Its subscriptions end with the session.
+	signaler := wamp_webrtc_go.NewWAMPOffererSignaler(session, procedureWebRTCOffer, topicAnswererOnCandidate,
+		topicOffererOnCandidate)
+	t.Cleanup(func() { _ = session.Leave() })
+
+	config := wampClientConfig(session)
+	config.Signaler = signaler
+	config.ProcedureICEServers = procedureICEServers
+	config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	client, err := wamp_webrtc_go.ConnectWAMP(config)
+	require.NoError(t, err)
+
+	var base xconn.BaseSession
+	select {
+	case base = <-sessions:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "session was not handed to OnSession")
+	}
+	require.Equal(t, client.ID(), base.ID())
+	t.Cleanup(func() { _ = base.Close() })
+
+	// The client only gathered relay candidates, so all traffic goes through the TURN server.
+	details, ok := wamp_webrtc_go.ConnectionDetailsOf(base)
+	require.True(t, ok)
+	require.True(t, details.Relayed())
+}
+
+func TestProviderAnswererLifecycle(t *testing.T) {
+	provider, offererSignaler, sessions := setupMemoryProvider(t, &wamp_webrtc_go.ProviderConfig{})
+
+	t.Run("FailedOffer", func(t *testing.T) {
+		_, err := offererSignaler.SendOffer(context.Background(), "failed", &wamp_webrtc_go.Offer{
+			Description: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "invalid"},
+		})
+		require.Error(t, err)
+		require.Zero(t, provider.AnswererCount())
+	})
+
+	t.Run("ClosedConnection", func(t *testing.T) {
+		client, err := wamp_webrtc_go.ConnectWebRTC(&wamp_webrtc_go.ClientConfig{
+			Realm:      wamp_webrtc_go.DefaultRealm,
+			Serializer: xconn.CBORSerializerSpec,
+			Signaler:   offererSignaler,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = client.Connection.Close() })
+
+		webRTCSession := <-sessions
+		require.Equal(t, 1, provider.AnswererCount())
+
+		require.NoError(t, webRTCSession.Connection.Close())
+		require.Eventually(t, func() bool { return provider.AnswererCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Orphan", func(t *testing.T) {
+		candidate := &webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 127.0.0.1 9 typ host"}
+		require.NoError(t, offererSignaler.SendCandidate("orphan", candidate))
+		require.Eventually(t, func() bool { return provider.AnswererCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		provider.DropOrphans(time.Hour)
+		require.Equal(t, 1, provider.AnswererCount())
+
+		provider.DropOrphans(0)
+		require.Zero(t, provider.AnswererCount())
+	})
+}
@@ -0,0 +1,257 @@
+package wamp_webrtc_go
+
+import (
+	"context"
+	"sync"
+)
+
+// outgoingMessage is a message queued on a writeScheduler.
+type outgoingMessage struct {
+	chunker messageChunker
+	urgent  bool
+	started bool
+	result  chan error
+}
+
+// writeScheduler interleaves the chunks of concurrently written messages. Messages that fit
+// a single chunk, which covers the WAMP control messages and small calls, are sent ahead
+// of everything else, larger messages take turns chunk by chunk. Only one chunk is sent
+// at a time, either by runScheduler or by a writer sending directly while it is idle.
+type writeScheduler struct {
+	urgent   []*outgoingMessage
+	bulk     []*outgoingMessage
+	sending  bool
+	wake     chan struct{}
+	err      error
+	messages sync.Pool
+
+	sync.Mutex
+}
+
+func newWriteScheduler() *writeScheduler {
+	return &writeScheduler{wake: make(chan struct{}, 1)}
+}
+
+func (s *writeScheduler) push(message *outgoingMessage) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if message.urgent {
+		s.urgent = append(s.urgent, message)
+	} else {
+		s.bulk = append(s.bulk, message)
+	}
+
+	s.notify()
+	return nil
+}
+
+func (s *writeScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// acquire claims the data channel for a direct send, it fails while anything is queued or
+// being sent, which includes bulk messages between two of their chunks.
+func (s *writeScheduler) acquire() (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return false, s.err
+	}
+
+	if s.sending || len(s.urgent) > 0 || len(s.bulk) > 0 {
+		return false, nil
+	}
+
+	s.sending = true
+	return true, nil
+}
+
+// release hands the data channel back after a chunk was sent.
+func (s *writeScheduler) release() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sending = false
+	if len(s.urgent) > 0 || len(s.bulk) > 0 {
+		s.notify()
+	}
+}
+
+// pop returns the message to send the next chunk of and claims the data channel for it,
+// or nil if the queue is empty or a chunk is being sent directly.
+func (s *writeScheduler) pop() *outgoingMessage {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.sending {
+		return nil
+	}
+
+	var message *outgoingMessage
+	switch {
+	case len(s.urgent) > 0:
+		message, s.urgent = s.urgent[0], s.urgent[1:]
+	case len(s.bulk) > 0:
+		message, s.bulk = s.bulk[0], s.bulk[1:]
+	default:
+		return nil
+	}
+
+	message.started = true
+	s.sending = true
+	return message
+}
+
+// get returns a pooled message to queue.
+func (s *writeScheduler) get(chunker messageChunker, urgent bool) *outgoingMessage {
+	message, _ := s.messages.Get().(*outgoingMessage)
+	if message == nil {
+		message = &outgoingMessage{result: make(chan error, 1)}
+	}
+
+	message.chunker, message.urgent, message.started = chunker, urgent, false
+	return message
+}
+
+// put returns a message whose result was received to the pool.
+func (s *writeScheduler) put(message *outgoingMessage) {
+	message.chunker = messageChunker{}
+	s.messages.Put(message)
+}
+
+// cancel removes a message that didn't start yet, started messages are always completed
+// because the remote can't drop a partially received message.
+func (s *writeScheduler) cancel(message *outgoingMessage) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if message.started {
+		return false
+	}
+
+	s.urgent = removeMessage(s.urgent, message)
+	s.bulk = removeMessage(s.bulk, message)
+	return true
+}
+
+// fail rejects all queued and future messages with err.
+func (s *writeScheduler) fail(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.err = err
+	for _, message := range append(s.urgent, s.bulk...) {
+		message.result <- err
+	}
+
+	s.urgent, s.bulk = nil, nil
+}
+
+func removeMessage(messages []*outgoingMessage, message *outgoingMessage) []*outgoingMessage {
+	for i, queued := range messages {
+		if queued == message {
+			return append(messages[:i], messages[i+1:]...)
+		}
+	}
+
+	return messages
+}
+
+// runScheduler sends the chunks of queued messages until the peer terminates.
+func (w *WebRTCPeer) runScheduler() {
+	// pion copies sent data, so a single buffer serves all chunks.
+	var buffer []byte
+	for {
+		message := w.scheduler.pop()
+		if message == nil {
+			select {
+			case <-w.scheduler.wake:
+				continue
+			case <-w.done:
+				w.scheduler.fail(w.err)
+				return
+			}
+		}
+
+		chunk, final := message.chunker.next(buffer[:0])
+		buffer = chunk
+		if err := w.waitWritable(context.Background()); err != nil {
+			message.result <- err
+			w.scheduler.fail(err)
+			return
+		}
+
+		if err := w.channel.Send(chunk); err != nil {
+			w.scheduler.release()
+			message.result <- err
+			continue
+		}
+
+		if !final {
+			// Requeue behind the other bulk messages before releasing the channel, so direct
+			// sends can't mistake a partially sent message for an idle scheduler.
+			if err := w.scheduler.push(message); err != nil {
+				message.result <- err
+			}
+
+			w.scheduler.release()
+			continue
+		}
+
+		w.scheduler.release()
+		message.result <- nil
+	}
+}
+
+// scheduleWrite queues a message on the scheduler and waits until it was sent. Messages that
+// fit a single chunk are sent right away while the scheduler is idle.
+func (w *WebRTCPeer) scheduleWrite(ctx context.Context, bytes []byte) error {
+	urgent := w.assembler.fitsSingleChunk(len(bytes))
+	if urgent {
+		acquired, err := w.scheduler.acquire()
+		if err != nil {
+			return err
+		}
+
+		if acquired {
+			defer w.scheduler.release()
+			return w.assembler.WriteChunks(bytes, func(chunk []byte) error {
+				if err := w.waitWritable(ctx); err != nil {
+					return err
+				}
+
+				return w.channel.Send(chunk)
+			})
+		}
+	}
+
+	message := w.scheduler.get(w.assembler.newChunker(bytes), urgent)
+	if err := w.scheduler.push(message); err != nil {
+		w.scheduler.put(message)
+		return err
+	}
+
+	var err error
+	select {
+	case err = <-message.result:
+	case <-ctx.Done():
+		if w.scheduler.cancel(message) {
+			// The scheduler may have failed the message meanwhile, so it isn't reused.
+			return ctx.Err()
+		}
+
+		err = <-message.result
+	}
+
+	w.scheduler.put(message)
+	return err
+}
@@ -0,0 +1,26 @@
+package wamp_webrtc_go
+
+import (
+	"github.com/pion/webrtc/v4"
+)
+
+// newPeerConnection creates a peer connection with the given settings, which may be nil to
+// use the defaults. Data channels are detached if requested.
+func newPeerConnection(config webrtc.Configuration, settingEngine *webrtc.SettingEngine,
+	detachDataChannels bool) (*webrtc.PeerConnection, error) {
+	if settingEngine == nil && !detachDataChannels {
+		return webrtc.NewPeerConnection(config)
+	}
+
+	// Work on a copy, the settings may be shared by many connections.
+	var settings webrtc.SettingEngine
+	if settingEngine != nil {
+		settings = *settingEngine
+	}
+
+	if detachDataChannels {
+		settings.DetachDataChannels()
+	}
+
+	return webrtc.NewAPI(webrtc.WithSettingEngine(settings)).NewPeerConnection(config)
+}
@@ -0,0 +1,37 @@
+package wamp_webrtc_go_test
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/xconn-go"
+)
+
+func TestSettingEngine(t *testing.T) {
+	const portMin, portMax = 41000, 41100
+
+	settingEngine := &webrtc.SettingEngine{}
+	require.NoError(t, settingEngine.SetEphemeralUDPPortRange(portMin, portMax))
+
+	_, offererSignaler, sessions := setupMemoryProvider(t, &wamp_webrtc_go.ProviderConfig{SettingEngine: settingEngine})
+
+	client, err := wamp_webrtc_go.ConnectWebRTC(&wamp_webrtc_go.ClientConfig{
+		Realm:         wamp_webrtc_go.DefaultRealm,
+		Serializer:    xconn.CBORSerializerSpec,
+		Signaler:      offererSignaler,
+		SettingEngine: settingEngine,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Connection.Close() })
+
+	// Both sides share the settings and only use ports of the configured range.
+	for _, webRTCSession := range []*wamp_webrtc_go.WebRTCSession{<-sessions, client} {
+		details, err := webRTCSession.Details()
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, details.LocalCandidate.Port, uint16(portMin))
+		require.LessOrEqual(t, details.LocalCandidate.Port, uint16(portMax))
+	}
+}
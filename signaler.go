@@ -0,0 +1,53 @@
+package wamp_webrtc_go
+
+import (
+	"context"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// maxSignalingMessageSize limits the size of offers, answers and candidates read
+// by signalers.
+const maxSignalingMessageSize = 1 << 20
+
+// CandidateHandler receives ICE candidates trickled by the remote peer of a request.
+// A nil candidate marks the end of candidates.
+type CandidateHandler func(requestID string, candidate *webrtc.ICECandidateInit)
+
+// OfferHandler creates the answer to an offer made by a remote peer.
+type OfferHandler func(requestID string, offer *Offer) (*Answer, error)
+
+// Signaler exchanges ICE candidates between the two peers of a request.
+type Signaler interface {
+	// SendCandidate trickles a local candidate to the remote peer, a nil
+	// candidate signals the end of candidates.
+	SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error
+	// OnCandidate starts delivering remote candidates to handler.
+	OnCandidate(handler CandidateHandler) error
+	Close() error
+}
+
+// OffererSignaler is used by the side that initiates the connection.
+type OffererSignaler interface {
+	Signaler
+	// SendOffer delivers the offer to the remote peer and returns its answer.
+	SendOffer(ctx context.Context, requestID string, offer *Offer) (*Answer, error)
+}
+
+// AnswererSignaler is used by the side that accepts connections.
+type AnswererSignaler interface {
+	Signaler
+	// OnOffer starts delivering offers to handler.
+	OnOffer(handler OfferHandler) error
+	// Release drops any state kept for a request once its connection is gone.
+	Release(requestID string)
+}
+
+func candidateInit(candidate *webrtc.ICECandidate) *webrtc.ICECandidateInit {
+	if candidate == nil {
+		return nil
+	}
+
+	init := candidate.ToJSON()
+	return &init
+}
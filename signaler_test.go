@@ -0,0 +1,96 @@
+package wamp_webrtc_go_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/xconn-go"
+)
+
+// memorySignaler connects an offerer and an answerer directly, without a router.
+type memorySignaler struct {
+	peer *memorySignaler
+
+	onOffer     wamp_webrtc_go.OfferHandler
+	onCandidate wamp_webrtc_go.CandidateHandler
+
+	sync.Mutex
+}
+
+func newMemorySignalerPair() (*memorySignaler, *memorySignaler) {
+	offerer, answerer := &memorySignaler{}, &memorySignaler{}
+	offerer.peer, answerer.peer = answerer, offerer
+
+	return offerer, answerer
+}
+
+func (m *memorySignaler) SendOffer(_ context.Context, requestID string,
+	offer *wamp_webrtc_go.Offer) (*wamp_webrtc_go.Answer, error) {
+	m.peer.Lock()
+	handler := m.peer.onOffer
+	m.peer.Unlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("no offer handler")
+	}
+
+	return handler(requestID, offer)
+}
+
+func (m *memorySignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	m.peer.Lock()
+	handler := m.peer.onCandidate
+	m.peer.Unlock()
+
+	if handler != nil {
+		go handler(requestID, candidate)
+	}
+
+	return nil
+}
+
+func (m *memorySignaler) OnCandidate(handler wamp_webrtc_go.CandidateHandler) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.onCandidate = handler
+	return nil
+}
+
+func (m *memorySignaler) OnOffer(handler wamp_webrtc_go.OfferHandler) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.onOffer = handler
+	return nil
+}
+
+func (m *memorySignaler) Release(string) {}
+
+func (m *memorySignaler) Close() error {
+	return nil
+}
+
+func TestCustomSignaler(t *testing.T) {
+	_, offererSignaler, _ := setupMemoryProvider(t, &wamp_webrtc_go.ProviderConfig{Routed: true})
+
+	session, err := wamp_webrtc_go.ConnectWAMP(&wamp_webrtc_go.ClientConfig{
+		Realm:      wamp_webrtc_go.DefaultRealm,
+		Serializer: xconn.CBORSerializerSpec,
+		Signaler:   offererSignaler,
+	})
+	require.NoError(t, err)
+
+	registerResp := session.Register("io.xconn.echo", echo).Do()
+	require.NoError(t, registerResp.Err)
+
+	callResp := session.Call("io.xconn.echo").Arg("hello").Do()
+	require.NoError(t, callResp.Err)
+	require.Equal(t, "hello", callResp.Args.StringOr(0, ""))
+}
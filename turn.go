@@ -0,0 +1,110 @@
+package wamp_webrtc_go
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pion/turn/v4"
+)
+
+// DefaultTURNRealm is the realm of a TURN server whose config doesn't set one.
+const DefaultTURNRealm = "xconn.io"
+
+// TURNServerConfig configures a TURN server. Clients authenticate either with one of the
+// static Users, mapping usernames to passwords, or with credentials minted from Secret,
+// see TURNCredentials. RelayIP is the address relayed traffic is announced with, it may be
+// left out if ListenAddress has a specific IP.
+type TURNServerConfig struct {
+	ListenAddress string
+	RelayIP       net.IP
+	Realm         string
+	Users         map[string]string
+	Secret        string
+}
+
+// TURNServer is a STUN and TURN server listening on UDP.
+type TURNServer struct {
+	server *turn.Server
+	conn   net.PacketConn
+}
+
+// NewTURNServer starts a TURN server, it runs until closed.
+func NewTURNServer(config *TURNServerConfig) (*TURNServer, error) {
+	if len(config.Users) == 0 && config.Secret == "" {
+		return nil, fmt.Errorf("invalid turn config: either Users or Secret must be set")
+	}
+
+	conn, err := net.ListenPacket("udp4", config.ListenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relayed traffic leaves through the interface the server listens on.
+	listenIP := conn.LocalAddr().(*net.UDPAddr).IP
+	relayIP := config.RelayIP
+	if relayIP == nil {
+		if listenIP.IsUnspecified() {
+			_ = conn.Close()
+			return nil, fmt.Errorf("invalid turn config: RelayIP must be set when listening on %s", listenIP)
+		}
+
+		relayIP = listenIP
+	}
+
+	realm := config.Realm
+	if realm == "" {
+		realm = DefaultTURNRealm
+	}
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm:       realm,
+		AuthHandler: turnAuthHandler(config),
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: conn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: relayIP,
+				Address:      listenIP.String(),
+			},
+		}},
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &TURNServer{server: server, conn: conn}, nil
+}
+
+// turnAuthHandler accepts the static users first and TURN REST credentials otherwise.
+func turnAuthHandler(config *TURNServerConfig) turn.AuthHandler {
+	var restHandler turn.AuthHandler
+	if config.Secret != "" {
+		restHandler = turn.LongTermTURNRESTAuthHandler(config.Secret, nil)
+	}
+
+	return func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		if password, ok := config.Users[username]; ok {
+			return turn.GenerateAuthKey(username, realm, password), true
+		}
+
+		if restHandler == nil {
+			return nil, false
+		}
+
+		return restHandler(username, realm, srcAddr)
+	}
+}
+
+// Addr returns the UDP address the server listens on.
+func (s *TURNServer) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// URL returns the TURN URL of the server to use in a webrtc.ICEServer.
+func (s *TURNServer) URL() string {
+	return fmt.Sprintf("turn:%s?transport=udp", s.Addr())
+}
+
+func (s *TURNServer) Close() error {
+	return s.server.Close()
+}
@@ -0,0 +1,29 @@
+package wamp_webrtc_go_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+)
+
+func TestNewTURNServer(t *testing.T) {
+	_, err := wamp_webrtc_go.NewTURNServer(&wamp_webrtc_go.TURNServerConfig{ListenAddress: "127.0.0.1:0"})
+	require.Error(t, err)
+
+	// The relayed address can't be derived from a wildcard listen address.
+	_, err = wamp_webrtc_go.NewTURNServer(&wamp_webrtc_go.TURNServerConfig{
+		ListenAddress: "0.0.0.0:0",
+		Users:         map[string]string{"john": "hello"},
+	})
+	require.Error(t, err)
+
+	server, err := wamp_webrtc_go.NewTURNServer(&wamp_webrtc_go.TURNServerConfig{
+		ListenAddress: "127.0.0.1:0",
+		Users:         map[string]string{"john": "hello"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, server.URL(), "turn:127.0.0.1:")
+	require.NoError(t, server.Close())
+}
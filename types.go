@@ -1,6 +1,8 @@
 package wamp_webrtc_go
 
 import (
+	"time"
+
 	"github.com/pion/webrtc/v4"
 
 	"github.com/xconnio/wampproto-go/auth"
@@ -8,25 +10,63 @@ import (
 	"github.com/xconnio/xconn-go"
 )
 
+// DefaultRealm is served by the router a routed provider creates when
+// ProviderConfig.Router is not set.
+const DefaultRealm = "realm1"
+
+// An Offer carries the highest FramingVersion of its sender and an Answer the version
+// negotiated from it, peers predating versioned framing leave it out. See Compression for
+// the compression negotiation.
 type Answer struct {
 	Candidates  []webrtc.ICECandidateInit `json:"candidates"`
 	Description webrtc.SessionDescription `json:"description"`
+	Framing     FramingVersion            `json:"framing,omitempty"`
+	Compression []Compression             `json:"compression,omitempty"`
 }
 
 type Offer = Answer
 
+// OfferConfig and AnswerConfig set DetachDataChannels to use the data channels through a
+// DataChannelConn, detached channels can't be used by a WebRTCPeer. SettingEngine tunes
+// the peer connection, e.g. its UDP port range, NAT 1:1 IPs, interface filters, mDNS mode
+// or ICE timeouts. It is copied for every connection, so it may be shared.
 type OfferConfig struct {
-	Protocol                 string
-	ICEServers               []webrtc.ICEServer
-	Ordered                  bool
-	ID                       uint16
-	TopicAnswererOnCandidate string
+	Protocol           string
+	ICEServers         []webrtc.ICEServer
+	Ordered            bool
+	ID                 uint16
+	DetachDataChannels bool
+	ICETransportPolicy webrtc.ICETransportPolicy
+	SettingEngine      *webrtc.SettingEngine
 }
 
 type AnswerConfig struct {
-	ICEServers []webrtc.ICEServer
+	ICEServers         []webrtc.ICEServer
+	DetachDataChannels bool
+	SettingEngine      *webrtc.SettingEngine
+}
+
+// PeerConfig tunes a WebRTCPeer. Once more than HighWatermark bytes are queued on the data
+// channel, writes are handled according to Backpressure until the queue drains below
+// LowWatermark. Received messages larger than MaxMessageSize terminate the peer. ChunkSize
+// overrides the chunk size negotiated with the remote peer. Messages of at least
+// CompressionThreshold bytes are compressed if the session negotiated a Compression, zero
+// disables compression.
+type PeerConfig struct {
+	HighWatermark        uint64
+	LowWatermark         uint64
+	Backpressure         BackpressureMode
+	MaxMessageSize       int
+	ChunkSize            int
+	CompressionThreshold int
 }
 
+// ProviderConfig configures a WebRTCProvider. Offers are only answered with the ICE servers
+// in IceServers, plus DefaultICEServers if UseDefaultICEServers is set, otherwise those set
+// through WebRTCProvider.SetICEServers are kept. If
+// ProcedureICEServers is set, clients can fetch these servers through Session, TURN servers
+// get credentials minted from TURNSecret that expire after TURNCredentialTTL. SettingEngine
+// tunes the peer connections of accepted clients, see AnswerConfig.
 type ProviderConfig struct {
 	Session                     *xconn.Session
 	ProcedureHandleOffer        string
@@ -34,13 +74,31 @@ type ProviderConfig struct {
 	TopicPublishLocalCandidate  string
 	Serializer                  serializers.Serializer
 	Routed                      bool
+	Router                      *xconn.Router
 	Authenticator               auth.ServerAuthenticator
 	IceServers                  []webrtc.ICEServer
+	OnSession                   SessionHandler
+	BridgeURL                   string
+	Signaler                    AnswererSignaler
+	PeerConfig                  *PeerConfig
+	UseDefaultICEServers        bool
+	ProcedureICEServers         string
+	TURNSecret                  string
+	TURNCredentialTTL           time.Duration
+	SettingEngine               *webrtc.SettingEngine
 }
 
+// SessionHandler is called with every session accepted by a non-routed provider.
+// The handler owns the session: it must read from it and close it when done.
+type SessionHandler func(base xconn.BaseSession, webRTCSession *WebRTCSession)
+
 type WebRTCSession struct {
-	Connection *webrtc.PeerConnection
-	Channel    *webrtc.DataChannel
+	Connection  *webrtc.PeerConnection
+	Channel     *webrtc.DataChannel
+	Framing     FramingVersion
+	Compression Compression
+
+	states *connectionStates
 }
 
 func (w *WebRTCSession) OpenChannel(label string, options *webrtc.DataChannelInit) (*webrtc.DataChannel, error) {
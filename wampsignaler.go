@@ -0,0 +1,425 @@
+package wamp_webrtc_go
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/xconn-go"
+)
+
+// WAMPOffererSignaler signals through a WAMP router: the offer is sent by calling the
+// provider's offer procedure and candidates are exchanged using pub/sub. Every OnCandidate
+// subscribes to the candidates of the provider until Close.
+type WAMPOffererSignaler struct {
+	session                  *xconn.Session
+	procedureWebRTCOffer     string
+	topicAnswererOnCandidate string
+	topicOffererOnCandidate  string
+
+	subscriptions []xconn.SubscribeResponse
+
+	sync.Mutex
+}
+
+func NewWAMPOffererSignaler(session *xconn.Session, procedureWebRTCOffer, topicAnswererOnCandidate,
+	topicOffererOnCandidate string) *WAMPOffererSignaler {
+	return &WAMPOffererSignaler{
+		session:                  session,
+		procedureWebRTCOffer:     procedureWebRTCOffer,
+		topicAnswererOnCandidate: topicAnswererOnCandidate,
+		topicOffererOnCandidate:  topicOffererOnCandidate,
+	}
+}
+
+func (w *WAMPOffererSignaler) SendOffer(ctx context.Context, requestID string, offer *Offer) (*Answer, error) {
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Disclose ourselves so the provider can bind the request to this session.
+	callResponse := w.session.Call(w.procedureWebRTCOffer).
+		Args(requestID, string(offerJSON)).
+		Option("disclose_me", true).
+		DoContext(ctx)
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if callResponse.Err != nil {
+		return nil, callResponse.Err
+	}
+
+	answerText, err := callResponse.Args.String(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var answer Answer
+	if err = json.Unmarshal([]byte(answerText), &answer); err != nil {
+		return nil, err
+	}
+
+	return &answer, nil
+}
+
+func (w *WAMPOffererSignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	candidateJSON, err := marshalCandidate(candidate)
+	if err != nil {
+		return err
+	}
+
+	return w.session.Publish(w.topicAnswererOnCandidate).
+		Args(requestID, candidateJSON).
+		Option("disclose_me", true).
+		Do().Err
+}
+
+func (w *WAMPOffererSignaler) OnCandidate(handler CandidateHandler) error {
+	subscribeResponse := w.session.Subscribe(w.topicOffererOnCandidate, func(event *xconn.Event) {
+		requestID, candidate, err := parseCandidateEvent(event)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+
+		handler(requestID, candidate)
+	}).Do()
+	if subscribeResponse.Err != nil {
+		return subscribeResponse.Err
+	}
+
+	w.Lock()
+	w.subscriptions = append(w.subscriptions, subscribeResponse)
+	w.Unlock()
+
+	return nil
+}
+
+func (w *WAMPOffererSignaler) Close() error {
+	w.Lock()
+	subscriptions := w.subscriptions
+	w.subscriptions = nil
+	w.Unlock()
+
+	for _, subscription := range subscriptions {
+		if err := subscription.Unsubscribe(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pendingCandidates holds candidates that arrived before the offer of their request.
+type pendingCandidates struct {
+	created    time.Time
+	publishers []uint64
+	candidates []*webrtc.ICECandidateInit
+}
+
+// WAMPAnswererSignaler is the provider side of WAMPOffererSignaler. Each request is
+// bound to the WAMP session that made the offer: candidates published by other
+// sessions are rejected and local candidates are only delivered to the owner.
+// This relies on the router disclosing callers and publishers, offers and candidates
+// of undisclosed sessions are rejected.
+type WAMPAnswererSignaler struct {
+	session                     *xconn.Session
+	procedureHandleOffer        string
+	topicHandleRemoteCandidates string
+	topicPublishLocalCandidate  string
+
+	onCandidate CandidateHandler
+	owners      map[string]uint64
+	pending     map[string]*pendingCandidates
+
+	registrations []xconn.RegisterResponse
+	subscriptions []xconn.SubscribeResponse
+
+	sync.Mutex
+}
+
+func NewWAMPAnswererSignaler(session *xconn.Session, procedureHandleOffer, topicHandleRemoteCandidates,
+	topicPublishLocalCandidate string) *WAMPAnswererSignaler {
+	return &WAMPAnswererSignaler{
+		session:                     session,
+		procedureHandleOffer:        procedureHandleOffer,
+		topicHandleRemoteCandidates: topicHandleRemoteCandidates,
+		topicPublishLocalCandidate:  topicPublishLocalCandidate,
+		owners:                      make(map[string]uint64),
+		pending:                     make(map[string]*pendingCandidates),
+	}
+}
+
+func (w *WAMPAnswererSignaler) OnOffer(handler OfferHandler) error {
+	registerResponse := w.session.Register(w.procedureHandleOffer,
+		func(_ context.Context, invocation *xconn.Invocation) *xconn.InvocationResult {
+			return w.handleOffer(invocation, handler)
+		}).Do()
+	if registerResponse.Err != nil {
+		return registerResponse.Err
+	}
+
+	w.Lock()
+	w.registrations = append(w.registrations, registerResponse)
+	w.Unlock()
+
+	return nil
+}
+
+func (w *WAMPAnswererSignaler) handleOffer(invocation *xconn.Invocation, handler OfferHandler) *xconn.InvocationResult {
+	if len(invocation.Args()) < 2 {
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument)
+	}
+
+	requestID, err := invocation.ArgString(0)
+	if err != nil {
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, "request ID must be a string")
+	}
+
+	offerJSON, err := invocation.ArgString(1)
+	if err != nil {
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, "offer JSON must be a string")
+	}
+
+	var offer Offer
+	if err := json.Unmarshal([]byte(offerJSON), &offer); err != nil {
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+	}
+
+	candidates, err := w.bindOwner(requestID, invocation.Caller())
+	if err != nil {
+		return xconn.NewInvocationError(wampproto.ErrNotAuthorized, err.Error())
+	}
+
+	w.Lock()
+	onCandidate := w.onCandidate
+	w.Unlock()
+
+	if onCandidate != nil {
+		for _, candidate := range candidates {
+			onCandidate(requestID, candidate)
+		}
+	}
+
+	answer, err := handler(requestID, &offer)
+	if err != nil {
+		// The request never got a connection, don't keep it bound.
+		w.Release(requestID)
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+	}
+
+	answerData, err := json.Marshal(answer)
+	if err != nil {
+		return xconn.NewInvocationError(wampproto.ErrInvalidArgument, err.Error())
+	}
+
+	return xconn.NewInvocationResult(string(answerData))
+}
+
+// bindOwner assigns the request to the session that made the offer and returns the
+// candidates that session sent ahead of it. Candidates from other sessions are dropped.
+func (w *WAMPAnswererSignaler) bindOwner(requestID string, caller uint64) ([]*webrtc.ICECandidateInit, error) {
+	if caller == 0 {
+		return nil, fmt.Errorf("caller must be disclosed")
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if owner, bound := w.owners[requestID]; bound && owner != caller {
+		return nil, fmt.Errorf("request %s is owned by another session", requestID)
+	}
+
+	w.owners[requestID] = caller
+
+	var candidates []*webrtc.ICECandidateInit
+	if pending, ok := w.pending[requestID]; ok {
+		for i, publisher := range pending.publishers {
+			if publisher != caller {
+				log.Warnf("dropping candidate for request %s from session %d", requestID, publisher)
+				continue
+			}
+
+			candidates = append(candidates, pending.candidates[i])
+		}
+		delete(w.pending, requestID)
+	}
+
+	return candidates, nil
+}
+
+func (w *WAMPAnswererSignaler) OnCandidate(handler CandidateHandler) error {
+	w.Lock()
+	w.onCandidate = handler
+	w.Unlock()
+
+	subscribeResponse := w.session.Subscribe(w.topicHandleRemoteCandidates, w.onRemoteCandidate).Do()
+	if subscribeResponse.Err != nil {
+		return subscribeResponse.Err
+	}
+
+	w.Lock()
+	w.subscriptions = append(w.subscriptions, subscribeResponse)
+	w.Unlock()
+
+	return nil
+}
+
+func (w *WAMPAnswererSignaler) onRemoteCandidate(event *xconn.Event) {
+	requestID, candidate, err := parseCandidateEvent(event)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+
+	publisher := event.Publisher()
+	if publisher == 0 {
+		log.Warnf("rejecting candidate for request %s from undisclosed publisher", requestID)
+		return
+	}
+
+	w.Lock()
+	owner, bound := w.owners[requestID]
+	if !bound {
+		w.dropStalePending()
+		pending, ok := w.pending[requestID]
+		if !ok {
+			pending = &pendingCandidates{created: time.Now()}
+			w.pending[requestID] = pending
+		}
+		pending.publishers = append(pending.publishers, publisher)
+		pending.candidates = append(pending.candidates, candidate)
+	}
+	handler := w.onCandidate
+	w.Unlock()
+
+	if !bound {
+		return
+	}
+
+	if publisher != owner {
+		log.Warnf("rejecting candidate for request %s from session %d", requestID, publisher)
+		return
+	}
+
+	handler(requestID, candidate)
+}
+
+// dropStalePending forgets candidates of requests that never got an offer,
+// must be called with the lock held.
+func (w *WAMPAnswererSignaler) dropStalePending() {
+	for requestID, pending := range w.pending {
+		if time.Since(pending.created) > answererTimeout {
+			delete(w.pending, requestID)
+		}
+	}
+}
+
+func (w *WAMPAnswererSignaler) SendCandidate(requestID string, candidate *webrtc.ICECandidateInit) error {
+	candidateJSON, err := marshalCandidate(candidate)
+	if err != nil {
+		return err
+	}
+
+	w.Lock()
+	owner, bound := w.owners[requestID]
+	w.Unlock()
+
+	// Only the session that made the offer may see our candidates.
+	if !bound {
+		return fmt.Errorf("request %s is not bound to a session", requestID)
+	}
+
+	return w.session.Publish(w.topicPublishLocalCandidate).
+		Args(requestID, candidateJSON).
+		Option("eligible", []uint64{owner}).
+		Do().Err
+}
+
+func (w *WAMPAnswererSignaler) Release(requestID string) {
+	w.Lock()
+	defer w.Unlock()
+
+	delete(w.owners, requestID)
+	delete(w.pending, requestID)
+}
+
+func (w *WAMPAnswererSignaler) Close() error {
+	w.Lock()
+	registrations, subscriptions := w.registrations, w.subscriptions
+	w.registrations, w.subscriptions = nil, nil
+	w.Unlock()
+
+	for _, registration := range registrations {
+		if err := registration.Unregister(); err != nil {
+			return err
+		}
+	}
+
+	for _, subscription := range subscriptions {
+		if err := subscription.Unsubscribe(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// marshalCandidate encodes a candidate for the wire, the end of candidates is sent
+// as an empty candidate which older peers simply ignore.
+func marshalCandidate(candidate *webrtc.ICECandidateInit) (string, error) {
+	if candidate == nil {
+		candidate = &webrtc.ICECandidateInit{}
+	}
+
+	candidateJSON, err := json.Marshal(candidate)
+	if err != nil {
+		return "", err
+	}
+
+	return string(candidateJSON), nil
+}
+
+func unmarshalCandidate(candidateJSON string) (*webrtc.ICECandidateInit, error) {
+	var candidate webrtc.ICECandidateInit
+	if err := json.Unmarshal([]byte(candidateJSON), &candidate); err != nil {
+		return nil, err
+	}
+
+	if candidate.Candidate == "" {
+		return nil, nil
+	}
+
+	return &candidate, nil
+}
+
+func parseCandidateEvent(event *xconn.Event) (string, *webrtc.ICECandidateInit, error) {
+	if len(event.Args()) < 2 {
+		return "", nil, fmt.Errorf("invalid arguments length")
+	}
+
+	requestID, err := event.ArgString(0)
+	if err != nil {
+		return "", nil, fmt.Errorf("request ID must be a string")
+	}
+
+	candidateJSON, err := event.ArgString(1)
+	if err != nil {
+		return "", nil, fmt.Errorf("candidate must be a string")
+	}
+
+	candidate, err := unmarshalCandidate(candidateJSON)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return requestID, candidate, nil
+}
@@ -0,0 +1,167 @@
+package wamp_webrtc_go_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xconnio/wamp-webrtc-go"
+	"github.com/xconnio/wampproto-go"
+	"github.com/xconnio/xconn-go"
+)
+
+// failingRequest is the request ID whose offers the signaler of setupAnswererSignaler fails.
+const failingRequest = "failing"
+
+// setupAnswererSignaler serves offers on a router that discloses callers and publishers
+// if disclose is set, candidates accepted by the signaler are delivered to the channel.
+func setupAnswererSignaler(t *testing.T, disclose bool) (*xconn.Router, *wamp_webrtc_go.WAMPAnswererSignaler,
+	chan *webrtc.ICECandidateInit) {
+	router := xconn.NewRouter()
+	require.NoError(t, router.AddRealm("realm1"))
+	require.NoError(t, router.AutoDiscloseCaller("realm1", disclose))
+	require.NoError(t, router.AutoDisclosePublisher("realm1", disclose))
+	t.Cleanup(router.Close)
+
+	session, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+
+	signaler := wamp_webrtc_go.NewWAMPAnswererSignaler(session, procedureWebRTCOffer, topicAnswererOnCandidate,
+		topicOffererOnCandidate)
+	t.Cleanup(func() { _ = signaler.Close() })
+
+	candidates := make(chan *webrtc.ICECandidateInit, 1)
+	require.NoError(t, signaler.OnCandidate(func(_ string, candidate *webrtc.ICECandidateInit) {
+		candidates <- candidate
+	}))
+	require.NoError(t, signaler.OnOffer(func(requestID string, _ *wamp_webrtc_go.Offer) (*wamp_webrtc_go.Answer, error) {
+		if requestID == failingRequest {
+			return nil, errors.New("offer failed")
+		}
+
+		return &wamp_webrtc_go.Answer{}, nil
+	}))
+
+	return router, signaler, candidates
+}
+
+func sendOffer(session *xconn.Session, requestID string) error {
+	offer := wamp_webrtc_go.Offer{Description: webrtc.SessionDescription{Type: webrtc.SDPTypeOffer}}
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+
+	return session.Call(procedureWebRTCOffer).Args(requestID, string(offerJSON)).Do().Err
+}
+
+func publishCandidate(t *testing.T, session *xconn.Session, requestID, candidate string) {
+	candidateJSON, err := json.Marshal(webrtc.ICECandidateInit{Candidate: candidate})
+	require.NoError(t, err)
+
+	publishResponse := session.Publish(topicAnswererOnCandidate).
+		Args(requestID, string(candidateJSON)).
+		Acknowledge(true).
+		Do()
+	require.NoError(t, publishResponse.Err)
+}
+
+func TestWAMPAnswererSignalerOwner(t *testing.T) {
+	router, signaler, candidates := setupAnswererSignaler(t, true)
+
+	owner, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+	intruder, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+
+	received := make(chan string, 2)
+	for _, session := range []*xconn.Session{owner, intruder} {
+		name := "owner"
+		if session == intruder {
+			name = "intruder"
+		}
+
+		subscribeResponse := session.Subscribe(topicOffererOnCandidate, func(*xconn.Event) {
+			received <- name
+		}).Do()
+		require.NoError(t, subscribeResponse.Err)
+	}
+
+	require.NoError(t, sendOffer(owner, "request"))
+
+	// The intruder can neither take over the request nor inject candidates into it.
+	require.Error(t, sendOffer(intruder, "request"))
+	publishCandidate(t, intruder, "request", "candidate:intruder")
+	publishCandidate(t, owner, "request", "candidate:owner")
+
+	select {
+	case candidate := <-candidates:
+		require.Equal(t, "candidate:owner", candidate.Candidate)
+	case <-time.After(time.Second):
+		require.FailNow(t, "candidate of the owner was not accepted")
+	}
+
+	select {
+	case <-candidates:
+		require.FailNow(t, "candidate of the intruder was accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Candidates of the provider are published for the owner only, the in-memory router
+	// ignores eligible so only the delivery to the owner can be checked here.
+	require.NoError(t, signaler.SendCandidate("request", &webrtc.ICECandidateInit{Candidate: "candidate:provider"}))
+	for delivered := false; !delivered; {
+		select {
+		case name := <-received:
+			delivered = name == "owner"
+		case <-time.After(time.Second):
+			require.FailNow(t, "candidate of the provider was not delivered")
+		}
+	}
+
+	// Requests nobody offered on are never broadcast.
+	require.Error(t, signaler.SendCandidate("unknown", &webrtc.ICECandidateInit{Candidate: "candidate:provider"}))
+}
+
+func TestWAMPAnswererSignalerUndisclosed(t *testing.T) {
+	router, _, candidates := setupAnswererSignaler(t, false)
+
+	session, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+
+	err = sendOffer(session, "request")
+	var callErr *xconn.Error
+	require.ErrorAs(t, err, &callErr)
+	require.Equal(t, wampproto.ErrNotAuthorized, callErr.URI)
+
+	publishCandidate(t, session, "request", "candidate:undisclosed")
+	select {
+	case <-candidates:
+		require.FailNow(t, "candidate of an undisclosed publisher was accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWAMPAnswererSignalerFailedOffer(t *testing.T) {
+	router, signaler, _ := setupAnswererSignaler(t, true)
+
+	session, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+	other, err := xconn.ConnectInMemory(router, "realm1")
+	require.NoError(t, err)
+
+	err = sendOffer(session, failingRequest)
+	var callErr *xconn.Error
+	require.ErrorAs(t, err, &callErr)
+	require.Equal(t, wampproto.ErrInvalidArgument, callErr.URI)
+
+	// The failed request isn't bound to its caller anymore.
+	require.Error(t, signaler.SendCandidate(failingRequest, &webrtc.ICECandidateInit{Candidate: "candidate:provider"}))
+	err = sendOffer(other, failingRequest)
+	require.ErrorAs(t, err, &callErr)
+	require.Equal(t, wampproto.ErrInvalidArgument, callErr.URI)
+}
@@ -2,45 +2,91 @@ package wamp_webrtc_go
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
 )
 
+const (
+	// DefaultMaxMessageSize is the largest message a WebRTCMessageAssembler reassembles by default.
+	DefaultMaxMessageSize = 64 << 20
+
+	// maxInFlightMessages bounds the number of interleaved messages being reassembled at once,
+	// together they never buffer more than the max message size.
+	maxInFlightMessages = 1024
+)
+
+var (
+	ErrMalformedFrame  = errors.New("malformed webrtc frame")
+	ErrMessageTooLarge = errors.New("webrtc message too large")
+)
+
 type WebRTCMessageAssembler struct {
-	buffer *bytes.Buffer
+	buffer         *bytes.Buffer
+	inFlight       map[uint64]*bytes.Buffer
+	buffered       int
+	maxMessageSize int
+	framing        FramingVersion
+	chunkSize      int
+	nextMessageID  uint64
+	buffers        sync.Pool
+
+	compression          Compression
+	compressionThreshold int
+	compressionStats     CompressionStats
+	compressors          sync.Pool
+	decompressor         io.ReadCloser
 
 	sync.Mutex
 }
 
 func NewWebRTCMessageAssembler() *WebRTCMessageAssembler {
 	return &WebRTCMessageAssembler{
-		buffer: bytes.NewBuffer(nil),
+		buffer:         bytes.NewBuffer(nil),
+		inFlight:       make(map[uint64]*bytes.Buffer),
+		maxMessageSize: DefaultMaxMessageSize,
+		chunkSize:      minChunkSize,
 	}
 }
 
-func (m *WebRTCMessageAssembler) ChunkMessage(message []byte) chan []byte {
+// SetMaxMessageSize limits the size of reassembled messages, larger ones are rejected by Feed.
+func (m *WebRTCMessageAssembler) SetMaxMessageSize(size int) {
 	m.Lock()
 	defer m.Unlock()
 
-	chunkSize := 16*1024 - 1
-	totalChunks := (len(message) + chunkSize - 1) / chunkSize
+	m.maxMessageSize = size
+}
 
-	chunks := make(chan []byte)
+// SetFraming sets the chunk header format of outgoing chunks, received chunks are accepted
+// in any supported format.
+func (m *WebRTCMessageAssembler) SetFraming(version FramingVersion) {
+	m.Lock()
+	defer m.Unlock()
 
-	go func() {
-		for i := 0; i < totalChunks; i++ {
-			start := i * chunkSize
-			end := start + chunkSize
-			if i == totalChunks-1 {
-				end = len(message)
-			}
-			chunk := message[start:end]
+	m.framing = version
+}
 
-			var isFinal byte = 0
-			if i == totalChunks-1 {
-				isFinal = 1
-			}
+// SetChunkSize sets the size of outgoing chunks including their header, see
+// WebRTCSession.ChunkSize for the largest size the remote peer accepts.
+func (m *WebRTCMessageAssembler) SetChunkSize(size int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.chunkSize = max(size, minFrameSize)
+}
+
+// ChunkMessage returns the chunks of message through a channel fed by a goroutine. Prefer
+// WriteChunks, which neither spawns a goroutine nor allocates every chunk.
+func (m *WebRTCMessageAssembler) ChunkMessage(message []byte) chan []byte {
+	chunker := m.newChunker(message)
+	chunks := make(chan []byte)
 
-			chunks <- append([]byte{isFinal}, chunk...)
+	go func() {
+		for final := false; !final; {
+			var chunk []byte
+			chunk, final = chunker.next(nil)
+			chunks <- chunk
 		}
 		close(chunks)
 	}()
@@ -48,17 +94,165 @@ func (m *WebRTCMessageAssembler) ChunkMessage(message []byte) chan []byte {
 	return chunks
 }
 
-func (m *WebRTCMessageAssembler) Feed(data []byte) []byte {
+// WriteChunks passes the chunks of message to send one after the other. The chunk is only
+// valid until send returns, its buffer is reused for the next one.
+func (m *WebRTCMessageAssembler) WriteChunks(message []byte, send func(chunk []byte) error) error {
+	chunker := m.newChunker(message)
+
+	buffer, _ := m.buffers.Get().(*[]byte)
+	if buffer == nil {
+		buffer = new([]byte)
+	}
+	defer m.buffers.Put(buffer)
+
+	for final := false; !final; {
+		var chunk []byte
+		chunk, final = chunker.next((*buffer)[:0])
+		*buffer = chunk
+
+		if err := send(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newChunker prepares splitting message into chunks of the configured framing and size,
+// compressing it first if enabled.
+func (m *WebRTCMessageAssembler) newChunker(message []byte) messageChunker {
+	message, compressed := m.compress(message)
+
 	m.Lock()
 	defer m.Unlock()
 
-	m.buffer.Write(data[1:])
-	isFinal := data[0]
-	if isFinal == 1 {
-		out := m.buffer.Bytes()
-		m.buffer.Reset()
-		return out
+	header := frameHeader{version: m.framing}
+	if compressed {
+		header.flags |= frameFlagCompressed
 	}
 
-	return nil
+	if m.framing >= FramingVersion2 && len(message) > m.chunkSize-header.size() {
+		// Only messages spanning several chunks need an ID to be told apart.
+		m.nextMessageID++
+		header.flags |= frameFlagMessageID
+		header.messageID = m.nextMessageID
+	}
+
+	return messageChunker{
+		message:     message,
+		header:      header,
+		payloadSize: m.chunkSize - header.size(),
+	}
+}
+
+// messageChunker cuts a message into chunks, one at a time.
+type messageChunker struct {
+	message     []byte
+	header      frameHeader
+	payloadSize int
+	offset      int
+}
+
+// next appends the next chunk to dst and reports whether it is the final one. An empty
+// message still gets its final chunk.
+func (c *messageChunker) next(dst []byte) ([]byte, bool) {
+	end := min(c.offset+c.payloadSize, len(c.message))
+	final := end == len(c.message)
+
+	header := c.header
+	if !final {
+		header.flags |= frameFlagContinuation
+	}
+
+	if dst == nil {
+		dst = make([]byte, 0, header.size()+end-c.offset)
+	}
+
+	dst = append(header.appendTo(dst), c.message[c.offset:end]...)
+	c.offset = end
+
+	return dst, final
+}
+
+// Feed adds a received chunk and returns the message once its final chunk arrived. The
+// returned message may share memory with data.
+func (m *WebRTCMessageAssembler) Feed(data []byte) ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	header, payload, err := parseFrame(data)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := m.buffer
+	if header.hasMessageID() {
+		buffer = m.inFlight[header.messageID]
+		if buffer == nil {
+			if len(m.inFlight) >= maxInFlightMessages {
+				return nil, fmt.Errorf("%w: too many interleaved messages", ErrMalformedFrame)
+			}
+
+			buffer = bytes.NewBuffer(nil)
+			m.inFlight[header.messageID] = buffer
+		}
+	}
+
+	if buffer.Len()+len(payload) > m.maxMessageSize {
+		m.release(header, buffer)
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrMessageTooLarge, m.maxMessageSize)
+	}
+
+	// Interleaved messages must not add up to more than a single message may take.
+	if m.buffered+len(payload) > m.maxMessageSize {
+		m.release(header, buffer)
+		return nil, fmt.Errorf("%w: interleaved messages exceed %d bytes", ErrMessageTooLarge, m.maxMessageSize)
+	}
+
+	if !header.final() {
+		m.append(buffer, payload)
+		return nil, nil
+	}
+
+	defer m.release(header, buffer)
+	if header.compressed() {
+		if buffer.Len() == 0 {
+			return m.decompress(payload)
+		}
+
+		m.append(buffer, payload)
+		return m.decompress(buffer.Bytes())
+	}
+
+	if buffer.Len() == 0 {
+		return payload, nil
+	}
+
+	m.append(buffer, payload)
+	return bytes.Clone(buffer.Bytes()), nil
+}
+
+// append adds payload to the reassembly buffer of a message.
+func (m *WebRTCMessageAssembler) append(buffer *bytes.Buffer, payload []byte) {
+	buffer.Write(payload)
+	m.buffered += len(payload)
+}
+
+// release drops the reassembly state of the message the chunk belongs to.
+func (m *WebRTCMessageAssembler) release(header frameHeader, buffer *bytes.Buffer) {
+	m.buffered -= buffer.Len()
+	if header.hasMessageID() {
+		delete(m.inFlight, header.messageID)
+		return
+	}
+
+	buffer.Reset()
+}
+
+// fitsSingleChunk reports whether a message of the given size is sent as a single chunk.
+func (m *WebRTCMessageAssembler) fitsSingleChunk(size int) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return size <= m.chunkSize-1
 }
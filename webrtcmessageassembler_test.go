@@ -1,6 +1,11 @@
 package wamp_webrtc_go_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -43,7 +48,9 @@ func TestWebRTCMessageAssembler(t *testing.T) {
 		var finalMessage []byte
 
 		for chunk := range chunks {
-			finalMessage = assembler.Feed(chunk)
+			var err error
+			finalMessage, err = assembler.Feed(chunk)
+			require.NoError(t, err)
 			if chunk[0] != 1 {
 				require.Nil(t, finalMessage)
 			}
@@ -51,4 +58,288 @@ func TestWebRTCMessageAssembler(t *testing.T) {
 
 		require.Equal(t, message, finalMessage)
 	})
+
+	t.Run("WriteChunks", func(t *testing.T) {
+		message := make([]byte, 40*1024)
+		for i := range message {
+			message[i] = byte(i % 256)
+		}
+
+		sender := wamp_webrtc_go.NewWebRTCMessageAssembler()
+		sender.SetFraming(wamp_webrtc_go.FramingVersion2)
+		receiver := wamp_webrtc_go.NewWebRTCMessageAssembler()
+
+		var received []byte
+		var chunkCount int
+		err := sender.WriteChunks(message, func(chunk []byte) error {
+			chunkCount++
+			require.LessOrEqual(t, len(chunk), 16*1024)
+
+			out, err := receiver.Feed(chunk)
+			received = out
+			return err
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, chunkCount)
+		require.Equal(t, message, received)
+
+		require.ErrorIs(t, sender.WriteChunks(message, func([]byte) error {
+			return wamp_webrtc_go.ErrBufferFull
+		}), wamp_webrtc_go.ErrBufferFull)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		assembler := wamp_webrtc_go.NewWebRTCMessageAssembler()
+
+		_, err := assembler.Feed(nil)
+		require.ErrorIs(t, err, wamp_webrtc_go.ErrMalformedFrame)
+
+		_, err = assembler.Feed([]byte{2, 'a'})
+		require.ErrorIs(t, err, wamp_webrtc_go.ErrMalformedFrame)
+	})
+
+	t.Run("MaxMessageSize", func(t *testing.T) {
+		assembler := wamp_webrtc_go.NewWebRTCMessageAssembler()
+		assembler.SetMaxMessageSize(4)
+
+		_, err := assembler.Feed([]byte{0, 'a', 'b', 'c'})
+		require.NoError(t, err)
+
+		_, err = assembler.Feed([]byte{0, 'd', 'e'})
+		require.ErrorIs(t, err, wamp_webrtc_go.ErrMessageTooLarge)
+	})
+}
+
+func TestWebRTCMessageAssemblerFraming(t *testing.T) {
+	message := make([]byte, 20*1024)
+
+	assembler := wamp_webrtc_go.NewWebRTCMessageAssembler()
+	assembler.SetFraming(wamp_webrtc_go.FramingVersion1)
+
+	var headers []byte
+	var received []byte
+	for chunk := range assembler.ChunkMessage(message) {
+		headers = append(headers, chunk[0])
+
+		out, err := assembler.Feed(chunk)
+		require.NoError(t, err)
+		if out != nil {
+			received = out
+		}
+	}
+	require.Equal(t, []byte{0x91, 0x90}, headers)
+	require.Equal(t, message, received)
+
+	// Legacy peers keep working whatever the local framing is.
+	out, err := assembler.Feed([]byte{0, 'a'})
+	require.NoError(t, err)
+	require.Nil(t, out)
+	out, err = assembler.Feed([]byte{1, 'b'})
+	require.NoError(t, err)
+	require.Equal(t, []byte("ab"), out)
+
+	for _, header := range []byte{0x98, 0x94, 0xb0, 0x40} {
+		_, err = assembler.Feed([]byte{header, 'a'})
+		require.ErrorIs(t, err, wamp_webrtc_go.ErrMalformedFrame)
+	}
+}
+
+func TestWebRTCMessageAssemblerInterleaved(t *testing.T) {
+	sender := wamp_webrtc_go.NewWebRTCMessageAssembler()
+	sender.SetFraming(wamp_webrtc_go.FramingVersion2)
+	receiver := wamp_webrtc_go.NewWebRTCMessageAssembler()
+
+	first, second := bytes.Repeat([]byte{1}, 40*1024), bytes.Repeat([]byte{2}, 40*1024)
+	firstChunks, secondChunks := sender.ChunkMessage(first), sender.ChunkMessage(second)
+
+	var received [][]byte
+	for firstChunks != nil || secondChunks != nil {
+		for _, chunks := range []*chan []byte{&firstChunks, &secondChunks} {
+			if *chunks == nil {
+				continue
+			}
+
+			chunk, ok := <-*chunks
+			if !ok {
+				*chunks = nil
+				continue
+			}
+
+			out, err := receiver.Feed(chunk)
+			require.NoError(t, err)
+			if out != nil {
+				received = append(received, out)
+			}
+		}
+	}
+
+	require.Equal(t, [][]byte{first, second}, received)
+
+	// Messages fitting a single chunk don't need an ID.
+	for chunk := range sender.ChunkMessage([]byte("hello")) {
+		require.Equal(t, append([]byte{0xa0}, "hello"...), chunk)
+	}
+
+	// Messages that never complete can't add up to more than the max message size.
+	receiver.SetMaxMessageSize(64 * 1024)
+	var err error
+	for id := uint64(1); id <= 1024 && err == nil; id++ {
+		frame := binary.AppendUvarint([]byte{0xa5}, id)
+		_, err = receiver.Feed(append(frame, make([]byte, 1000)...))
+	}
+	require.ErrorIs(t, err, wamp_webrtc_go.ErrMessageTooLarge)
+}
+
+func TestWebRTCMessageAssemblerCompression(t *testing.T) {
+	message := bytes.Repeat([]byte(`{"procedure":"io.xconn.echo","args":[1,2,3]}`), 2000)
+
+	sender := wamp_webrtc_go.NewWebRTCMessageAssembler()
+	sender.SetFraming(wamp_webrtc_go.FramingVersion2)
+	sender.SetCompression(wamp_webrtc_go.CompressionDeflate, 1024)
+	receiver := wamp_webrtc_go.NewWebRTCMessageAssembler()
+	receiver.SetCompression(wamp_webrtc_go.CompressionDeflate, 0)
+
+	var chunks [][]byte
+	require.NoError(t, sender.WriteChunks(message, func(chunk []byte) error {
+		chunks = append(chunks, bytes.Clone(chunk))
+		return nil
+	}))
+	require.Len(t, chunks, 1)
+	require.Equal(t, byte(0xa2), chunks[0][0])
+
+	received, err := receiver.Feed(chunks[0])
+	require.NoError(t, err)
+	require.Equal(t, message, received)
+
+	stats := sender.CompressionStats()
+	require.Equal(t, uint64(1), stats.Messages)
+	require.Equal(t, uint64(len(message)), stats.Bytes)
+	require.Less(t, stats.Ratio(), 0.1)
+
+	// Messages below the threshold are sent as is.
+	require.NoError(t, sender.WriteChunks([]byte("hello"), func(chunk []byte) error {
+		require.Equal(t, append([]byte{0xa0}, "hello"...), chunk)
+		return nil
+	}))
+
+	// Compressed frames are only accepted once compression was negotiated.
+	_, err = wamp_webrtc_go.NewWebRTCMessageAssembler().Feed(chunks[0])
+	require.ErrorIs(t, err, wamp_webrtc_go.ErrMalformedFrame)
+
+	receiver.SetMaxMessageSize(1024)
+	_, err = receiver.Feed(chunks[0])
+	require.ErrorIs(t, err, wamp_webrtc_go.ErrMessageTooLarge)
+}
+
+func FuzzWebRTCMessageAssembler(f *testing.F) {
+	f.Add([]byte("hello"), []byte{2, 1, 'a'}, uint16(0), false)
+	f.Add([]byte{}, []byte{1, 0}, uint16(0), false)
+	f.Add(make([]byte, 40*1024), []byte{}, uint16(0), false)
+	// Interleaved chunks of two version 2 messages with IDs, then a compressed final chunk.
+	f.Add([]byte("hello"), []byte{3, 0xa5, 1, 'a', 3, 0xa5, 2, 'b', 3, 0xa4, 1, 'c', 3, 0xa4, 2, 'd', 2, 0xa2, 0},
+		uint16(32), true)
+	f.Add(bytes.Repeat([]byte("compressible "), 1000), []byte{3, 0xa5, 1, 'a'}, uint16(64), true)
+
+	const maxMessageSize = 4096
+
+	newAssembler := func(chunkSize uint16, compressed bool) *wamp_webrtc_go.WebRTCMessageAssembler {
+		assembler := wamp_webrtc_go.NewWebRTCMessageAssembler()
+		assembler.SetFraming(wamp_webrtc_go.FramingVersion2)
+		if chunkSize > 0 {
+			assembler.SetChunkSize(int(chunkSize))
+		}
+		if compressed {
+			assembler.SetCompression(wamp_webrtc_go.CompressionDeflate, 1)
+		}
+
+		return assembler
+	}
+
+	f.Fuzz(func(t *testing.T, message []byte, frames []byte, chunkSize uint16, compressed bool) {
+		// Arbitrary frames, each prefixed by its length, must never panic nor produce a
+		// message beyond the limit.
+		assembler := newAssembler(chunkSize, compressed)
+		assembler.SetMaxMessageSize(maxMessageSize)
+		for len(frames) > 0 {
+			size := min(int(frames[0]), len(frames)-1)
+			out, err := assembler.Feed(frames[1 : 1+size])
+			if err == nil {
+				require.LessOrEqual(t, len(out), maxMessageSize)
+			}
+			frames = frames[1+size:]
+		}
+
+		// Chunked messages always survive the round trip, also when interleaved. Tiny chunks
+		// of large messages would only slow the fuzzer down.
+		chunkSize = max(chunkSize, uint16(min(len(message)/256, math.MaxUint16)))
+		sender := newAssembler(chunkSize, compressed)
+		receiver := newAssembler(chunkSize, compressed)
+		reversed := slices.Clone(message)
+		slices.Reverse(reversed)
+
+		var received [][]byte
+		first, second := sender.ChunkMessage(message), sender.ChunkMessage(reversed)
+		for first != nil || second != nil {
+			for _, chunks := range []*chan []byte{&first, &second} {
+				if *chunks == nil {
+					continue
+				}
+
+				chunk, ok := <-*chunks
+				if !ok {
+					*chunks = nil
+					continue
+				}
+
+				out, err := receiver.Feed(chunk)
+				require.NoError(t, err)
+				if out != nil {
+					received = append(received, bytes.Clone(out))
+				}
+			}
+		}
+
+		require.Len(t, received, 2)
+		require.ElementsMatch(t, []string{string(message), string(reversed)},
+			[]string{string(received[0]), string(received[1])})
+	})
+}
+
+func TestNegotiateChunkSize(t *testing.T) {
+	const sdp = "v=0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=sctp-port:5000\r\n"
+
+	require.Equal(t, 64*1024-1, wamp_webrtc_go.NegotiateChunkSize(sdp))
+	require.Equal(t, 1024, wamp_webrtc_go.NegotiateChunkSize(sdp+"a=max-message-size:1024\r\n"))
+	require.Equal(t, 32*1024, wamp_webrtc_go.NegotiateChunkSize(sdp+"a=max-message-size:32768\r\n"))
+	require.Equal(t, 64*1024-1, wamp_webrtc_go.NegotiateChunkSize(sdp+"a=max-message-size:262144\r\n"))
+	require.Equal(t, 64*1024-1, wamp_webrtc_go.NegotiateChunkSize(sdp+"a=max-message-size:0\r\n"))
+	require.Equal(t, 64*1024-1, wamp_webrtc_go.NegotiateChunkSize(sdp+"a=max-message-size:invalid\r\n"))
+}
+
+func BenchmarkChunking(b *testing.B) {
+	for _, size := range []int{1024, 1024 * 1024} {
+		message := make([]byte, size)
+
+		b.Run(fmt.Sprintf("ChunkMessage/%d", size), func(b *testing.B) {
+			assembler := wamp_webrtc_go.NewWebRTCMessageAssembler()
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+
+			for range b.N {
+				for range assembler.ChunkMessage(message) {
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("WriteChunks/%d", size), func(b *testing.B) {
+			assembler := wamp_webrtc_go.NewWebRTCMessageAssembler()
+			send := func([]byte) error { return nil }
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+
+			for range b.N {
+				_ = assembler.WriteChunks(message, send)
+			}
+		})
+	}
 }